@@ -31,7 +31,6 @@ type Api struct {
 	language          string
 	authData          string
 	client            *http.Client
-	authResponseCache map[string]string
 	commitEndpoint    string
 	commitRetryConfig *RetryConfig
 }
@@ -41,28 +40,98 @@ type AuthResponse struct {
 	Auth   string
 }
 
-func NewApi() (*Api, error) {
-	selectedEmail := AppConfig.Selected
-	if len(selectedEmail) == 0 {
-		return nil, fmt.Errorf("no account is selected")
+// ErrAuthFailed is matched by errors.Is for failures caused by missing or
+// rejected credentials, as opposed to network or upload errors.
+var ErrAuthFailed = errors.New("authentication failed")
+
+// authError tags err as an ErrAuthFailed without changing its message.
+type authError struct {
+	err error
+}
+
+func (e authError) Error() string {
+	return e.err.Error()
+}
+
+func (e authError) Unwrap() []error {
+	return []error{ErrAuthFailed, e.err}
+}
+
+// ActiveAccount returns the email of the account commands work with: the
+// per-command Account override, or else the selected account.
+func ActiveAccount() string {
+	if AppConfig.Account != "" {
+		return AppConfig.Account
+	}
+	return AppConfig.Selected
+}
+
+// AccountCredential returns the stored auth string of the account email.
+func AccountCredential(email string) (string, error) {
+	if len(email) == 0 {
+		return "", authError{errors.New("no account is selected")}
 	}
-	credentials := ""
-	language := ""
 	for _, c := range AppConfig.Credentials {
 		params, err := url.ParseQuery(c)
 		if err != nil {
 			continue
 		}
-		if params.Get("Email") == selectedEmail {
-			credentials = c
-			language = params.Get("lang")
+		if params.Get("Email") == email {
+			return c, nil
 		}
 	}
+	if !CredentialsAvailable() {
+		return "", authError{ErrCredentialsLocked}
+	}
+	return "", authError{fmt.Errorf("no credentials found for %s", email)}
+}
 
-	if len(credentials) == 0 {
-		return nil, fmt.Errorf("no credentials with matching selected email found")
+// MatchAccount resolves query to the email of a stored credential. An exact
+// match wins; otherwise query must be a case-insensitive substring of exactly
+// one email.
+func MatchAccount(query string) (string, error) {
+	var candidates []string
+	for _, cred := range AppConfig.Credentials {
+		email := credentialEmail(cred)
+		if email == "" {
+			continue
+		}
+		if email == query {
+			return email, nil
+		}
+		if strings.Contains(strings.ToLower(email), strings.ToLower(query)) {
+			candidates = append(candidates, email)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		if !CredentialsAvailable() {
+			return "", ErrCredentialsLocked
+		}
+		return "", fmt.Errorf("no credentials found matching '%s'", query)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("multiple credentials match '%s':\n  - %s\nPlease be more specific", query, strings.Join(candidates, "\n  - "))
+	}
+}
+
+// newAccountApi returns a client for the stored credential of email.
+func newAccountApi(email string) (*Api, error) {
+	credential, err := AccountCredential(email)
+	if err != nil {
+		return nil, err
 	}
+	return NewApi(credential)
+}
 
+// NewApi returns a client that signs in with the auth string credential.
+func NewApi(credential string) (*Api, error) {
+	params, err := url.ParseQuery(credential)
+	if err != nil {
+		return nil, authError{fmt.Errorf("invalid auth string: %w", err)}
+	}
 	client, err := NewHTTPClientWithProxy(AppConfig.Proxy)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
@@ -73,13 +142,9 @@ func NewApi() (*Api, error) {
 		model:             "Pixel XL",
 		make:              "Google",
 		clientVersionCode: 49029607,
-		language:          language,
-		authData:          strings.TrimSpace(credentials),
+		language:          params.Get("lang"),
+		authData:          strings.TrimSpace(credential),
 		client:            client,
-		authResponseCache: map[string]string{
-			"Expiry": "0",
-			"Auth":   "",
-		},
 	}
 
 	api.userAgent = fmt.Sprintf(
@@ -92,26 +157,19 @@ func NewApi() (*Api, error) {
 	return api, nil
 }
 
+// BearerToken returns the token of the Api's credential. It is shared with
+// every other Api for the same credential in the process.
 func (a *Api) BearerToken() (string, error) {
-	expiryStr := a.authResponseCache["Expiry"]
-	expiry, err := strconv.ParseInt(expiryStr, 10, 64)
-	if err != nil {
-		return "", fmt.Errorf("invalid expiry time: %w", err)
-	}
-
-	if expiry <= time.Now().Unix() {
-		resp, err := a.getAuthToken()
-		if err != nil {
-			return "", fmt.Errorf("failed to get auth token: %w", err)
-		}
-		a.authResponseCache = resp
-	}
+	return bearerTokens.token(a.authData, a.getAuthToken)
+}
 
-	if token, ok := a.authResponseCache["Auth"]; ok && token != "" {
-		return token, nil
+// rejectBearerToken drops token when the server answered resp with 401, so
+// that the next request, and a retry of this one, exchanges the credential
+// again instead of sending the revoked token until it expires.
+func (a *Api) rejectBearerToken(resp *http.Response, token string) {
+	if resp.StatusCode == http.StatusUnauthorized {
+		bearerTokens.invalidate(a.authData, token)
 	}
-
-	return "", errors.New("auth response does not contain bearer token")
 }
 
 func (a *Api) getAuthToken() (map[string]string, error) {
@@ -134,7 +192,7 @@ func (a *Api) getAuthToken() (map[string]string, error) {
 		var assertionJWT string
 		tokenBinding, assertionJWT, err = newTokenBindingSession(alias)
 		if err != nil {
-			return nil, fmt.Errorf("failed to prepare token binding assertion: %w", err)
+			return nil, tokenBindingError{fmt.Errorf("failed to prepare token binding assertion: %w", err)}
 		}
 		authRequestData.Set("assertion_jwt", assertionJWT)
 	}
@@ -171,7 +229,11 @@ func (a *Api) getAuthToken() (map[string]string, error) {
 	// Check for errors
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := ReadResponseBody(resp)
-		return make(map[string]string), fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		err := fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return make(map[string]string), authError{err}
+		}
+		return make(map[string]string), err
 	}
 
 	// Parse the response body
@@ -193,12 +255,12 @@ func (a *Api) getAuthToken() (map[string]string, error) {
 		}
 	}
 	if err := decryptTokenEncryptedResponse(parsedAuthResponse, tokenBinding); err != nil {
-		return nil, err
+		return nil, tokenBindingError{err}
 	}
 
 	// Validate we got the required fields
 	if parsedAuthResponse["Auth"] == "" {
-		return nil, errors.New("auth response missing Auth token")
+		return nil, authError{errors.New("auth response missing Auth token")}
 	}
 	if parsedAuthResponse["Expiry"] == "" {
 		return nil, errors.New("auth response missing Expiry")
@@ -207,7 +269,12 @@ func (a *Api) getAuthToken() (map[string]string, error) {
 	return parsedAuthResponse, nil
 }
 
-// Obtain a file upload token from the Google Photos API.
+// errUploadHashRequired reports that the server refused an upload token
+// requested without X-Goog-Hash, so the file must be hashed before sending.
+var errUploadHashRequired = errors.New("server requires the hash before the upload")
+
+// Obtain a file upload token from the Google Photos API. An empty shaHashB64
+// omits X-Goog-Hash and defers the hash to the commit.
 func (a *Api) GetUploadToken(shaHashB64 string, fileSize int64) (string, error) {
 	// Create the protobuf message
 	protoBody := generated.GetUploadToken{
@@ -237,9 +304,11 @@ func (a *Api) GetUploadToken(shaHashB64 string, fileSize int64) (string, error)
 		"Content-Type":            "application/x-protobuf",
 		"User-Agent":              a.userAgent,
 		"Authorization":           "Bearer " + bearerToken,
-		"X-Goog-Hash":             "sha1=" + shaHashB64,
 		"X-Upload-Content-Length": strconv.Itoa(int(fileSize)),
 	}
+	if shaHashB64 != "" {
+		headers["X-Goog-Hash"] = "sha1=" + shaHashB64
+	}
 
 	// Create the request
 	req, err := http.NewRequest(
@@ -265,9 +334,16 @@ func (a *Api) GetUploadToken(shaHashB64 string, fileSize int64) (string, error)
 
 	// Check for errors
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := ReadResponseBody(resp)
-		return "", fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		a.rejectBearerToken(resp, bearerToken)
+		err := newHTTPStatusError(resp)
+		uploadCongestion.observe(err)
+		if shaHashB64 == "" && resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusTooManyRequests {
+			return "", fmt.Errorf("%w: %w", errUploadHashRequired, err)
+		}
+		return "", err
 	}
+	uploadCongestion.observe(nil)
 
 	// Get the upload token from headers
 	uploadToken := resp.Header.Get("X-GUploader-UploadID")
@@ -278,8 +354,13 @@ func (a *Api) GetUploadToken(shaHashB64 string, fileSize int64) (string, error)
 	return uploadToken, nil
 }
 
-// Check library for existing files with the hash
-func (a *Api) FindRemoteMediaByHash(shaHash []byte) (string, error) {
+// Check library for existing files with the hash. Like uploads, the lookup
+// waits out a shared pause after the server throttled.
+func (a *Api) FindRemoteMediaByHash(ctx context.Context, shaHash []byte) (string, error) {
+	if err := uploadCongestion.backoff(ctx, 0); err != nil {
+		return "", err
+	}
+
 	// Create the protobuf message
 
 	// Create and initialize the protobuf message with all required nested structures
@@ -314,7 +395,8 @@ func (a *Api) FindRemoteMediaByHash(shaHash []byte) (string, error) {
 	}
 
 	// Create the request
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
 		"https://photosdata-pa.googleapis.com/6439526531001121323/5084965799730810217",
 		bytes.NewReader(serializedData),
@@ -337,9 +419,12 @@ func (a *Api) FindRemoteMediaByHash(shaHash []byte) (string, error) {
 
 	// Check for errors
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := ReadResponseBody(resp)
-		return "", fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		a.rejectBearerToken(resp, bearerToken)
+		err := newHTTPStatusError(resp)
+		uploadCongestion.observe(err)
+		return "", err
 	}
+	uploadCongestion.observe(nil)
 
 	// Parse the response body
 	bodyBytes, err := ReadResponseBody(resp)
@@ -365,7 +450,50 @@ func (a *Api) UploadFile(ctx context.Context, filePath string, uploadToken strin
 	return a.UploadFileWithProgress(ctx, filePath, uploadToken, nil)
 }
 
+// errUploadSessionExpired reports that Scotty no longer knows the upload ID,
+// so the transfer must start over with a new token.
+var errUploadSessionExpired = errors.New("upload session is no longer available")
+
+// UploadFileWithProgress sends a file to a freshly issued upload session.
+// Retries ask the server how many bytes it already committed and continue
+// from that offset instead of resending the whole file.
 func (a *Api) UploadFileWithProgress(ctx context.Context, filePath string, uploadToken string, onProgress UploadProgressCallback) (ScottyFinalizeToken, error) {
+	return a.uploadFileWithProgress(ctx, filePath, uploadToken, false, nil, onProgress)
+}
+
+// UploadFileHashingWithProgress sends a file like UploadFileWithProgress and
+// computes its SHA-1 from the bytes as they are sent, so the file is read once.
+func (a *Api) UploadFileHashingWithProgress(ctx context.Context, filePath string, uploadToken string, onProgress UploadProgressCallback) (ScottyFinalizeToken, []byte, error) {
+	return a.uploadFileHashingWithProgress(ctx, filePath, uploadToken, false, onProgress)
+}
+
+// ResumeUploadFileHashingWithProgress continues a session started by
+// UploadFileHashingWithProgress, possibly in another process.
+func (a *Api) ResumeUploadFileHashingWithProgress(ctx context.Context, filePath string, uploadToken string, onProgress UploadProgressCallback) (ScottyFinalizeToken, []byte, error) {
+	return a.uploadFileHashingWithProgress(ctx, filePath, uploadToken, true, onProgress)
+}
+
+func (a *Api) uploadFileHashingWithProgress(ctx context.Context, filePath string, uploadToken string, resume bool, onProgress UploadProgressCallback) (ScottyFinalizeToken, []byte, error) {
+	hasher := newStreamHasher()
+	token, err := a.uploadFileWithProgress(ctx, filePath, uploadToken, resume, hasher, onProgress)
+	if err != nil {
+		return ScottyFinalizeToken{}, nil, err
+	}
+	hash, err := hasher.sum(ctx, filePath)
+	if err != nil {
+		return ScottyFinalizeToken{}, nil, fmt.Errorf("error calculating hash file: %w", err)
+	}
+	return token, hash, nil
+}
+
+// ResumeUploadFileWithProgress continues an upload session created by an
+// earlier attempt, possibly in another process, by querying the committed
+// offset before the first transfer.
+func (a *Api) ResumeUploadFileWithProgress(ctx context.Context, filePath string, uploadToken string, onProgress UploadProgressCallback) (ScottyFinalizeToken, error) {
+	return a.uploadFileWithProgress(ctx, filePath, uploadToken, true, nil, onProgress)
+}
+
+func (a *Api) uploadFileWithProgress(ctx context.Context, filePath string, uploadToken string, resume bool, hasher *streamHasher, onProgress UploadProgressCallback) (ScottyFinalizeToken, error) {
 	// Get file size first (needed for progress tracking)
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
@@ -385,19 +513,41 @@ func (a *Api) UploadFileWithProgress(ctx context.Context, filePath string, uploa
 			return ScottyFinalizeToken{}, ctx.Err()
 		}
 
-		// Wait before retry (skip on first attempt)
+		// Wait before retry (skip on first attempt), and for as long as the
+		// server asked every worker to back off.
 		if attempt > 0 {
-			delay := CalculateBackoff(attempt-1, retryConfig)
-			select {
-			case <-ctx.Done():
-				return ScottyFinalizeToken{}, ctx.Err()
-			case <-time.After(delay):
+			if err := uploadCongestion.backoff(ctx, CalculateBackoff(attempt-1, retryConfig)); err != nil {
+				return ScottyFinalizeToken{}, err
+			}
+		}
+
+		// A failed attempt may still have committed a prefix of the file, and a
+		// resumed session may be partially or even fully transferred already.
+		var offset int64
+		if attempt > 0 || resume {
+			status, err := a.queryUploadStatus(ctx, uploadURL, fileSize)
+			if err != nil {
+				if errors.Is(err, errUploadSessionExpired) {
+					return ScottyFinalizeToken{}, err
+				}
+				lastErr = err
+				if ctx.Err() != nil {
+					return ScottyFinalizeToken{}, ctx.Err()
+				}
+				continue
 			}
+			if status.complete {
+				if onProgress != nil {
+					onProgress(fileSize, fileSize, attemptNum)
+				}
+				return status.token, nil
+			}
+			offset = status.received
 		}
 
-		// Signal start of this attempt (resets progress on retry)
+		// Signal start of this attempt (resets progress to the resume offset)
 		if onProgress != nil {
-			onProgress(0, fileSize, attemptNum)
+			onProgress(offset, fileSize, attemptNum)
 		}
 
 		// Open file fresh for each attempt - this is the key to not loading into memory
@@ -405,16 +555,27 @@ func (a *Api) UploadFileWithProgress(ctx context.Context, filePath string, uploa
 		if err != nil {
 			return ScottyFinalizeToken{}, fmt.Errorf("error opening file: %w", err)
 		}
+		if offset > 0 {
+			if _, err := file.Seek(offset, io.SeekStart); err != nil {
+				_ = file.Close()
+				return ScottyFinalizeToken{}, fmt.Errorf("error seeking to resume offset: %w", err)
+			}
+		}
 
 		// Wrap file in progress reader if callback provided
 		var reader io.Reader = file
+		if hasher != nil {
+			reader = hasher.reader(file, offset)
+		}
 		if onProgress != nil {
-			reader = NewProgressReader(file, fileSize, func(bytesRead, total int64) {
-				onProgress(bytesRead, total, attemptNum)
+			reader = NewProgressReader(reader, fileSize-offset, func(bytesRead, _ int64) {
+				onProgress(offset+bytesRead, fileSize, attemptNum)
 			})
 		}
+		reader = uploadBandwidth.reader(ctx, uploadCongestion.reader(reader))
 
-		result, err := a.doUploadRequest(ctx, uploadURL, reader)
+		result, err := a.doUploadRequest(ctx, uploadURL, reader, offset, fileSize)
+		uploadCongestion.observe(err)
 		closeErr := file.Close() // Close file after request completes (success or fail)
 		if err == nil && closeErr != nil {
 			return ScottyFinalizeToken{}, fmt.Errorf("error closing file: %w", closeErr)
@@ -435,8 +596,92 @@ func (a *Api) UploadFileWithProgress(ctx context.Context, filePath string, uploa
 	return ScottyFinalizeToken{}, fmt.Errorf("upload failed after %d attempts: %w", retryConfig.MaxRetries+1, lastErr)
 }
 
-// doUploadRequest performs a single upload attempt
-func (a *Api) doUploadRequest(ctx context.Context, uploadURL string, reader io.Reader) (ScottyFinalizeToken, error) {
+// uploadStatus is the server-side state of a Scotty upload session.
+type uploadStatus struct {
+	received int64
+	complete bool
+	token    ScottyFinalizeToken
+}
+
+// queryUploadStatus uses the resumable-upload status probe: an empty PUT with
+// "Content-Range: bytes */size". An incomplete session answers 308 with the
+// committed "Range: bytes=0-N"; a finished one answers 2xx with the finalize
+// token the original transfer would have returned.
+func (a *Api) queryUploadStatus(ctx context.Context, uploadURL string, fileSize int64) (uploadStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, "PUT", uploadURL, http.NoBody)
+	if err != nil {
+		return uploadStatus{}, fmt.Errorf("error creating status request: %w", err)
+	}
+
+	bearerToken, err := a.BearerToken()
+	if err != nil {
+		return uploadStatus{}, fmt.Errorf("failed to get bearer token: %w", err)
+	}
+
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Accept-Language", a.language)
+	req.Header.Set("User-Agent", a.userAgent)
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", fileSize))
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return uploadStatus{}, fmt.Errorf("status request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusPermanentRedirect:
+		received, err := parseUploadRangeHeader(resp.Header.Get("Range"))
+		if err != nil {
+			return uploadStatus{}, err
+		}
+		if received > fileSize {
+			return uploadStatus{}, fmt.Errorf("server reports %d bytes received for a %d-byte file", received, fileSize)
+		}
+		return uploadStatus{received: received}, nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return uploadStatus{}, errUploadSessionExpired
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		a.rejectBearerToken(resp, bearerToken)
+		body, _ := ReadResponseBody(resp)
+		return uploadStatus{}, fmt.Errorf("status request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	bodyBytes, err := ReadResponseBody(resp)
+	if err != nil {
+		return uploadStatus{}, fmt.Errorf("failed to read status response body: %w", err)
+	}
+	token, err := ParseScottyFinalizeToken(bodyBytes)
+	if err != nil {
+		return uploadStatus{}, fmt.Errorf("invalid upload finalize response: %w", err)
+	}
+	return uploadStatus{received: fileSize, complete: true, token: token}, nil
+}
+
+// parseUploadRangeHeader converts "bytes=0-N" into the number of committed
+// bytes. A missing header means nothing has been committed yet.
+func parseUploadRangeHeader(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	_, span, found := strings.Cut(value, "=")
+	if !found {
+		return 0, fmt.Errorf("invalid upload Range header %q", value)
+	}
+	_, last, found := strings.Cut(span, "-")
+	if !found {
+		return 0, fmt.Errorf("invalid upload Range header %q", value)
+	}
+	lastByte, err := strconv.ParseInt(strings.TrimSpace(last), 10, 64)
+	if err != nil || lastByte < 0 {
+		return 0, fmt.Errorf("invalid upload Range header %q", value)
+	}
+	return lastByte + 1, nil
+}
+
+// doUploadRequest performs a single upload attempt starting at offset
+func (a *Api) doUploadRequest(ctx context.Context, uploadURL string, reader io.Reader, offset, fileSize int64) (ScottyFinalizeToken, error) {
 	req, err := http.NewRequestWithContext(ctx, "PUT", uploadURL, reader)
 	if err != nil {
 		return ScottyFinalizeToken{}, fmt.Errorf("error creating request: %w", err)
@@ -454,6 +699,9 @@ func (a *Api) doUploadRequest(ctx context.Context, uploadURL string, reader io.R
 	req.Header.Set("Accept-Language", a.language)
 	req.Header.Set("User-Agent", a.userAgent)
 	req.Header.Set("Authorization", "Bearer "+bearerToken)
+	if offset > 0 {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, fileSize-1, fileSize))
+	}
 
 	resp, err := a.client.Do(req)
 	if err != nil {
@@ -463,8 +711,8 @@ func (a *Api) doUploadRequest(ctx context.Context, uploadURL string, reader io.R
 
 	// Check for non-success status codes (includes retryable 5xx/429 and non-retryable 4xx)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := ReadResponseBody(resp)
-		return ScottyFinalizeToken{}, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		a.rejectBearerToken(resp, bearerToken)
+		return ScottyFinalizeToken{}, newHTTPStatusError(resp)
 	}
 
 	bodyBytes, err := ReadResponseBody(resp)
@@ -480,6 +728,7 @@ func (a *Api) doUploadRequest(ctx context.Context, uploadURL string, reader io.R
 
 // CommitUpload commits the upload to Google Photos
 func (a *Api) CommitUpload(
+	ctx context.Context,
 	uploadResponseDecoded *generated.CommitToken,
 	fileName string,
 	sha1Hash []byte,
@@ -531,26 +780,29 @@ func (a *Api) CommitUpload(
 		return "", fmt.Errorf("failed to marshal protobuf: %w", err)
 	}
 
-	return a.commitSerialized(serializedData)
+	return a.commitSerialized(ctx, serializedData)
 }
 
-func (a *Api) CommitLivePhoto(input LivePhotoCreateRequest) (string, error) {
+func (a *Api) CommitLivePhoto(ctx context.Context, input LivePhotoCreateRequest) (string, error) {
 	serializedData, err := BuildLivePhotoCreateMediaItemsRequest(input)
 	if err != nil {
 		return "", fmt.Errorf("build Live Photo create request: %w", err)
 	}
-	return a.commitSerialized(serializedData)
+	return a.commitSerialized(ctx, serializedData)
 }
 
-func (a *Api) ReconcileLivePhoto(input LivePhotoReconcileRequest) (string, error) {
+func (a *Api) ReconcileLivePhoto(ctx context.Context, input LivePhotoReconcileRequest) (string, error) {
 	serializedData, err := BuildLivePhotoReconcileMediaItemsRequest(input)
 	if err != nil {
 		return "", fmt.Errorf("build Live Photo reconcile request: %w", err)
 	}
-	return a.commitSerialized(serializedData)
+	return a.commitSerialized(ctx, serializedData)
 }
 
-func (a *Api) commitSerialized(serializedData []byte) (string, error) {
+// commitSerialized sends a commit request, retrying transient failures.
+// Cancelling ctx stops the waits between attempts but never a request in
+// flight, whose outcome would otherwise be unknown.
+func (a *Api) commitSerialized(ctx context.Context, serializedData []byte) (string, error) {
 	retryConfig := DefaultRetryConfig()
 	if a.commitRetryConfig != nil {
 		retryConfig = *a.commitRetryConfig
@@ -558,10 +810,12 @@ func (a *Api) commitSerialized(serializedData []byte) (string, error) {
 	var lastErr error
 	for attempt := 0; attempt <= retryConfig.MaxRetries; attempt++ {
 		if attempt > 0 {
-			delay := CalculateBackoff(attempt-1, retryConfig)
-			time.Sleep(delay)
+			if err := uploadCongestion.backoff(ctx, CalculateBackoff(attempt-1, retryConfig)); err != nil {
+				return "", err
+			}
 		}
 		mediaKey, retryable, err := a.doCommitRequest(serializedData)
+		uploadCongestion.observe(err)
 		if err == nil {
 			return mediaKey, nil
 		}
@@ -608,8 +862,11 @@ func (a *Api) doCommitRequest(serializedData []byte) (mediaKey string, retryable
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := ReadResponseBody(resp)
-		return "", ShouldRetry(resp, nil), fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		// A rejected token means nothing was committed, so the retry with a
+		// fresh one cannot duplicate the item.
+		a.rejectBearerToken(resp, bearerToken)
+		retryable := ShouldRetry(resp, nil) || resp.StatusCode == http.StatusUnauthorized
+		return "", retryable, newHTTPStatusError(resp)
 	}
 
 	bodyBytes, err := ReadResponseBody(resp)
@@ -717,6 +974,7 @@ func (a *Api) CreateAlbum(albumName string, mediaKeys []string) (string, error)
 
 	// Check for errors
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		a.rejectBearerToken(resp, bearerToken)
 		body, _ := ReadResponseBody(resp)
 		return "", fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
 	}
@@ -807,6 +1065,7 @@ func (a *Api) AddMediaToAlbum(albumMediaKey string, mediaKeys []string) error {
 
 	// Check for errors
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		a.rejectBearerToken(resp, bearerToken)
 		body, _ := ReadResponseBody(resp)
 		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
 	}
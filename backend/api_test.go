@@ -0,0 +1,38 @@
+package backend
+
+import "testing"
+
+func TestParseUploadRangeHeader(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "bytes=0-0", want: 1},
+		{value: "bytes=0-1048575", want: 1 << 20},
+		{value: "bytes=0- 99", want: 100},
+		{value: "bytes 0-99", wantErr: true},
+		{value: "bytes=0", wantErr: true},
+		{value: "bytes=0-", wantErr: true},
+		{value: "bytes=0-abc", wantErr: true},
+		{value: "bytes=0--1", wantErr: true},
+		{value: "bytes=0-99999999999999999999", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseUploadRangeHeader(test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseUploadRangeHeader(%q) = %d, want an error", test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseUploadRangeHeader(%q) error: %v", test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseUploadRangeHeader(%q) = %d, want %d", test.value, got, test.want)
+		}
+	}
+}
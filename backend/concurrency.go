@@ -0,0 +1,243 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// adaptiveWindow is how long throughput is measured before the number of
+// active workers is changed again.
+const adaptiveWindow = 10 * time.Second
+
+// adaptiveHoldWindows is how many windows the worker count stays put after an
+// extra worker did not raise the throughput, so that a saturated link does not
+// make it grow and shrink every other window.
+const adaptiveHoldWindows = 6
+
+// maxThrottlePause caps a shared pause, including one asked for by
+// Retry-After, so that a bogus header cannot stall an upload for hours.
+const maxThrottlePause = 10 * time.Minute
+
+// concurrencyController coordinates the upload workers of a run. Every 429 or
+// 5xx response pauses all of them, for as long as Retry-After asks or else
+// with a backoff that grows while the server keeps refusing. In adaptive mode
+// it also decides how many workers may transfer at once: one more while that
+// raises the combined throughput, half as many after the server throttled.
+type concurrencyController struct {
+	mu       sync.Mutex
+	changed  chan struct{}
+	logger   *slog.Logger
+	adaptive bool
+	max      int
+	limit    int
+	active   int
+
+	pauseUntil time.Time
+	// throttles counts throttled responses since the last success and drives
+	// the shared backoff when the server sends no Retry-After.
+	throttles    int
+	lastDecrease time.Time
+
+	windowStart    time.Time
+	windowBytes    atomic.Int64
+	windowThrottle bool
+	// starved is set when a worker had to wait for a slot during the window,
+	// which is the only time more slots could help.
+	starved        bool
+	grew           bool
+	holdUntil      time.Time
+	lastThroughput float64
+}
+
+// uploadCongestion is shared by every upload in this process.
+var uploadCongestion = newConcurrencyController()
+
+func newConcurrencyController() *concurrencyController {
+	return &concurrencyController{changed: make(chan struct{}), max: 1, limit: 1}
+}
+
+// reset prepares the controller for a run with up to maxWorkers workers. In
+// adaptive mode the run starts with half of them.
+func (c *concurrencyController) reset(maxWorkers int, adaptive bool, logger *slog.Logger) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logger = logger
+	c.adaptive = adaptive
+	c.max = max(maxWorkers, 1)
+	c.limit = c.max
+	if adaptive {
+		c.limit = (c.max + 1) / 2
+	}
+	c.throttles = 0
+	c.windowStart = time.Now()
+	c.windowBytes.Store(0)
+	c.windowThrottle, c.starved, c.grew = false, false, false
+	c.holdUntil = time.Time{}
+	c.lastThroughput = 0
+	c.notifyLocked()
+}
+
+func (c *concurrencyController) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *concurrencyController) logf(level slog.Level, format string, args ...any) {
+	if c.logger != nil {
+		c.logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+	}
+}
+
+// acquire waits until a worker may start on an item: the shared pause is over
+// and fewer than the current limit are active. onWait is called once if it
+// has to wait. Every successful acquire must be paired with release.
+func (c *concurrencyController) acquire(ctx context.Context, onWait func()) error {
+	waited := false
+	for {
+		c.mu.Lock()
+		now := time.Now()
+		c.adjustLocked(now)
+		pause := c.pauseUntil.Sub(now)
+		if pause <= 0 && c.active < c.limit {
+			c.active++
+			c.mu.Unlock()
+			return nil
+		}
+		if pause <= 0 {
+			c.starved = true
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		if !waited && onWait != nil {
+			onWait()
+		}
+		waited = true
+		wait := pause
+		if wait <= 0 {
+			wait = adaptiveWindow
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (c *concurrencyController) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active--
+	c.notifyLocked()
+}
+
+// backoff replaces a retry loop's own sleep: it waits for delay or until the
+// shared pause is over, whichever is later.
+func (c *concurrencyController) backoff(ctx context.Context, delay time.Duration) error {
+	c.mu.Lock()
+	wait := max(delay, time.Until(c.pauseUntil))
+	c.mu.Unlock()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// observe records the outcome of one request. Only throttled responses and
+// successes matter; other failures say nothing about the server's load.
+func (c *concurrencyController) observe(err error) {
+	if err == nil {
+		c.mu.Lock()
+		c.throttles = 0
+		c.mu.Unlock()
+		return
+	}
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) || !statusErr.throttled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.throttles++
+	c.windowThrottle = true
+	delay := statusErr.RetryAfter
+	if delay <= 0 {
+		delay = CalculateBackoff(min(c.throttles-1, 10), DefaultRetryConfig())
+	}
+	delay = min(delay, maxThrottlePause)
+	if until := now.Add(delay); until.After(c.pauseUntil) {
+		c.pauseUntil = until
+		c.logf(slog.LevelWarn, "server returned status %d, pausing uploads for %s", statusErr.StatusCode, delay.Round(time.Second))
+	}
+	// Responses to requests that were already in flight say the same thing,
+	// so halve at most once per window.
+	if c.adaptive && c.limit > 1 && now.Sub(c.lastDecrease) >= adaptiveWindow {
+		c.limit = max(c.limit/2, 1)
+		c.lastDecrease = now
+		c.grew = false
+		c.logf(slog.LevelInfo, "server is throttling, reducing active upload threads to %d", c.limit)
+	}
+	c.notifyLocked()
+}
+
+// adjustLocked closes the measurement window once it is over. An extra
+// worker is kept only if it raised the throughput.
+func (c *concurrencyController) adjustLocked(now time.Time) {
+	elapsed := now.Sub(c.windowStart)
+	if !c.adaptive || elapsed < adaptiveWindow {
+		return
+	}
+	throughput := float64(c.windowBytes.Swap(0)) / elapsed.Seconds()
+	grew := false
+	switch {
+	case c.windowThrottle:
+		// Already reduced when the throttled response came in.
+	case c.grew && throughput < c.lastThroughput*1.05:
+		c.limit = max(c.limit-1, 1)
+		c.holdUntil = now.Add(adaptiveHoldWindows * adaptiveWindow)
+		c.logf(slog.LevelDebug, "another upload thread did not raise throughput, back to %d", c.limit)
+	case c.starved && c.limit < c.max && !now.Before(c.holdUntil):
+		c.limit++
+		grew = true
+		c.logf(slog.LevelDebug, "raising active upload threads to %d", c.limit)
+		c.notifyLocked()
+	}
+	c.grew = grew
+	c.lastThroughput = throughput
+	c.windowStart = now
+	c.windowThrottle, c.starved = false, false
+}
+
+// reader counts the bytes sent through r toward the throughput of the
+// current window.
+func (c *concurrencyController) reader(r io.Reader) io.Reader {
+	return &countingReader{controller: c, reader: r}
+}
+
+type countingReader struct {
+	controller *concurrencyController
+	reader     io.Reader
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.controller.windowBytes.Add(int64(n))
+	return n, err
+}
@@ -32,14 +32,55 @@ type Config struct {
 	SkipIncompleteLivePhotos      bool     `json:"skipIncompleteLivePhotos" koanf:"skip_incomplete_live_photos"`
 	UpdateExistingPhotosToLive    bool     `json:"updateExistingPhotosToLive" koanf:"update_existing_photos_to_live"`
 	UploadThreads                 int      `json:"uploadThreads" koanf:"upload_threads"`
+	HashThreads                   int      `json:"hashThreads" koanf:"hash_threads"`
+	AdaptiveThreads               bool     `json:"adaptiveThreads" koanf:"adaptive_threads"`
 	DeleteFromHost                bool     `json:"deleteFromHost" koanf:"delete_from_host"`
+	VerifyBeforeDelete            bool     `json:"verifyBeforeDelete" koanf:"verify_before_delete"`
+	TrashDir                      string   `json:"trashDir" koanf:"trash_dir"`
 	DisableUnsupportedFilesFilter bool     `json:"disableUnsupportedFilesFilter" koanf:"disable_unsupported_files_filter"`
 	AlbumName                     string   `json:"albumName" koanf:"album_name"`
 	AlbumAutoMode                 bool     `json:"albumAutoMode" koanf:"album_auto_mode"`
 	SetDateFromFilename           bool     `json:"setDateFromFilename" koanf:"set_date_from_filename"`
 	ExcludePattern                string   `json:"excludePattern" koanf:"exclude_pattern"`
+	// ScanThreads is how many directories are read at once during a scan.
+	ScanThreads int `json:"scanThreads" koanf:"scan_threads"`
+	// MaxDepth limits how many levels below a scanned directory a recursive
+	// scan descends. Zero means no limit.
+	MaxDepth int `json:"maxDepth" koanf:"max_depth"`
+	// FollowSymlinks descends into symlinked directories. Each directory is
+	// still scanned once, so links that point back up the tree are harmless.
+	FollowSymlinks bool `json:"followSymlinks" koanf:"follow_symlinks"`
+	// HashWhileUpload hashes new files during the transfer instead of reading
+	// them once for the hash and again for the upload.
+	HashWhileUpload bool `json:"hashWhileUpload" koanf:"hash_while_upload"`
+	// LimitRate caps the combined upload bandwidth of all workers, optionally
+	// by time of day. See ParseRateSchedule for the format.
+	LimitRate string `json:"limitRate" koanf:"limit_rate"`
+	// TokenCache keeps bearer tokens in a file next to the config so that
+	// short runs reuse a token that is still valid instead of signing in.
+	TokenCache bool `json:"tokenCache" koanf:"token_cache"`
+	// CredentialVault replaces Credentials in the config file once they are
+	// encrypted. It is never sent to the frontend.
+	CredentialVault CredentialVault `json:"-" koanf:"credential_vault,omitempty"`
+	// Routes send files to other accounts than the selected one by path. The
+	// first matching route wins.
+	Routes []AccountRoute `json:"routes" koanf:"routes"`
+	// ExcludePatterns and IncludePatterns use gitignore syntax and are matched
+	// against paths relative to each scanned directory.
+	ExcludePatterns []string `json:"excludePatterns" koanf:"exclude_patterns"`
+	IncludePatterns []string `json:"includePatterns" koanf:"include_patterns"`
 	// IgnoreAppleMetadata is a CLI-only per-command override and is never persisted.
 	IgnoreAppleMetadata bool `json:"-" koanf:"-"`
+	// Rehash is a CLI-only override that ignores the local hash cache.
+	Rehash bool `json:"-" koanf:"-"`
+	// MaxFailures stops dispatching new work once this many items have failed.
+	// Zero means no limit. CLI-only, like Rehash.
+	MaxFailures int `json:"-" koanf:"-"`
+	// Filters narrows the scanned files by size, date and media class. CLI-only.
+	Filters UploadFilters `json:"-" koanf:"-"`
+	// Account is the email of the account one command works with instead of
+	// Selected, which stays unchanged. CLI-only.
+	Account string `json:"-" koanf:"-"`
 }
 
 type ConfigManager struct{}
@@ -52,6 +93,8 @@ var (
 	DefaultConfig = Config{
 		SkipIncompleteLivePhotos: true,
 		UploadThreads:            3,
+		HashThreads:              2,
+		ScanThreads:              4,
 	}
 )
 
@@ -173,6 +216,11 @@ func (g *ConfigManager) GetExcludePattern() string {
 }
 
 func (g *ConfigManager) AddCredentials(newAuthString string) error {
+	// A closed vault would leave the new credential in plain text.
+	if !CredentialsAvailable() {
+		return ErrCredentialsLocked
+	}
+
 	// Required fields that must be present in the auth string
 	requiredFields := []string{
 		"androidId",
@@ -234,6 +282,10 @@ func (g *ConfigManager) CredentialNeedsTokenBinding(authString string) bool {
 }
 
 func (g *ConfigManager) AddTokenBindingAliasFromADB(email string) error {
+	// A closed vault hides the credential the alias belongs to.
+	if !CredentialsAvailable() {
+		return ErrCredentialsLocked
+	}
 	email = strings.TrimSpace(email)
 	if email == "" {
 		return fmt.Errorf("email cannot be empty")
@@ -261,6 +313,9 @@ func (g *ConfigManager) AddTokenBindingAliasFromADB(email string) error {
 }
 
 func (g *ConfigManager) RemoveCredentials(email string) error {
+	if !CredentialsAvailable() {
+		return ErrCredentialsLocked
+	}
 	if email == "" {
 		return fmt.Errorf("email cannot be empty")
 	}
@@ -561,13 +616,17 @@ func LoadConfig() error {
 		AppConfig = loadAppConfig()
 	}
 
-	return nil
+	return reopenCredentialVault()
 }
 
 func saveAppConfig() error {
 	k := koanf.New(".")
 
-	err := k.Load(structs.Provider(AppConfig, "koanf"), nil)
+	sealed, err := sealCredentialVault(AppConfig)
+	if err != nil {
+		return err
+	}
+	err = k.Load(structs.Provider(sealed, "koanf"), nil)
 	if err != nil {
 		fmt.Println(err)
 		return err
@@ -581,11 +640,13 @@ func saveAppConfig() error {
 		return err
 	}
 
-	err = os.WriteFile(ConfigPath, b, 0o644)
+	// The file holds credentials, so only the owner may read it.
+	err = os.WriteFile(ConfigPath, b, 0o600)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
+	_ = os.Chmod(ConfigPath, 0o600)
 
 	return nil
 }
@@ -610,6 +671,12 @@ func loadAppConfig() Config {
 	if c.UploadThreads < 1 {
 		c.UploadThreads = DefaultConfig.UploadThreads
 	}
+	if c.HashThreads < 1 {
+		c.HashThreads = DefaultConfig.HashThreads
+	}
+	if c.ScanThreads < 1 {
+		c.ScanThreads = DefaultConfig.ScanThreads
+	}
 
 	return c
 }
@@ -0,0 +1,328 @@
+package backend
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/tink-crypto/tink-go/v2/aead/subtle"
+	"golang.org/x/crypto/argon2"
+)
+
+// Key derivation methods of a CredentialVault.
+const (
+	CredentialVaultPassphrase = "argon2id"
+	CredentialVaultKeyFile    = "keyfile"
+)
+
+// PassphraseEnv supplies the vault passphrase to runs without a terminal,
+// such as cron jobs, the daemon and the GUI.
+const PassphraseEnv = "GOTOHP_PASSPHRASE"
+
+// credentialVaultAssociatedData binds the ciphertext to its purpose and
+// format version.
+var credentialVaultAssociatedData = []byte("gotohp credential vault v1")
+
+// Argon2id parameters for passphrase keys, as recommended by RFC 9106 for
+// memory constrained environments.
+const (
+	vaultArgonTime    = 3
+	vaultArgonMemory  = 64 << 10
+	vaultArgonThreads = 4
+	vaultKeySize      = 32
+	vaultSaltSize     = 16
+	minKeyFileSize    = 16
+)
+
+// ErrCredentialsLocked is returned when the credentials are encrypted and no
+// key has been supplied in this process.
+var ErrCredentialsLocked = fmt.Errorf("credentials are encrypted; enter the passphrase in a terminal, set %s or lock them with a key file", PassphraseEnv)
+
+// CredentialVault holds the credentials encrypted with AES-256-GCM. While a
+// vault is in use, Credentials only holds them in memory and the config file
+// keeps just the ciphertext.
+type CredentialVault struct {
+	KDF string `koanf:"kdf"`
+	// Salt is the base64 Argon2id salt of a passphrase vault.
+	Salt string `koanf:"salt"`
+	// KeyFile is the path of the key of a key file vault.
+	KeyFile    string `koanf:"key_file"`
+	Ciphertext string `koanf:"ciphertext"`
+}
+
+// vaultKey is the key of the vault in the config file once it has been
+// opened, so that saving the config can encrypt changed credentials again.
+var vaultKey []byte
+
+// CredentialsEncrypted reports whether the config file keeps the credentials
+// in a vault.
+func CredentialsEncrypted() bool {
+	return AppConfig.CredentialVault.KDF != ""
+}
+
+// CredentialsAvailable reports whether Credentials holds every credential,
+// either because they are stored in plain text or because the vault is open.
+func CredentialsAvailable() bool {
+	return !CredentialsEncrypted() || vaultKey != nil
+}
+
+// OpenCredentialVault decrypts the vault with passphrase and adds its
+// credentials to the ones stored in plain text.
+func OpenCredentialVault(passphrase string) error {
+	vault := AppConfig.CredentialVault
+	if vault.KDF != CredentialVaultPassphrase {
+		return fmt.Errorf("credentials are encrypted with a key file, not a passphrase")
+	}
+	key, err := passphraseVaultKey(passphrase, vault.Salt)
+	if err != nil {
+		return err
+	}
+	return openCredentialVault(key)
+}
+
+// reopenCredentialVault opens the vault of a freshly loaded config with the
+// key used before, or else without a prompt.
+func reopenCredentialVault() error {
+	key := vaultKey
+	vaultKey = nil
+	if !CredentialsEncrypted() {
+		return nil
+	}
+	if key != nil && openCredentialVault(key) == nil {
+		return nil
+	}
+	return openCredentialVaultWithoutPrompt()
+}
+
+// openCredentialVaultWithoutPrompt opens the vault from its key file or from
+// PassphraseEnv. Without either the vault stays closed.
+func openCredentialVaultWithoutPrompt() error {
+	if CredentialsAvailable() {
+		return nil
+	}
+	switch AppConfig.CredentialVault.KDF {
+	case CredentialVaultKeyFile:
+		key, err := readVaultKeyFile(AppConfig.CredentialVault.KeyFile)
+		if err != nil {
+			return err
+		}
+		return openCredentialVault(key)
+	case CredentialVaultPassphrase:
+		if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+			return OpenCredentialVault(passphrase)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown credential vault kdf %q", AppConfig.CredentialVault.KDF)
+	}
+}
+
+func openCredentialVault(key []byte) error {
+	credentials, err := decryptCredentials(AppConfig.CredentialVault.Ciphertext, key)
+	if err != nil {
+		return err
+	}
+	// Credentials added in plain text while the vault was closed are newer
+	// than the encrypted ones for the same account.
+	plain := AppConfig.Credentials
+	merged := make([]string, 0, len(credentials)+len(plain))
+	for _, cred := range credentials {
+		if !containsCredentialFor(plain, credentialEmail(cred)) {
+			merged = append(merged, cred)
+		}
+	}
+	AppConfig.Credentials = append(merged, plain...)
+	vaultKey = key
+	return nil
+}
+
+// EncryptCredentials stores the credentials in a new vault, keyed by
+// passphrase or, when keyFile is set, by the key in that file. A missing key
+// file is created with a random key. It also re-keys an open vault.
+func EncryptCredentials(passphrase string, keyFile string) error {
+	if !CredentialsAvailable() {
+		return ErrCredentialsLocked
+	}
+	var vault CredentialVault
+	var key []byte
+	if keyFile != "" {
+		path, err := filepath.Abs(keyFile)
+		if err != nil {
+			return err
+		}
+		if err := createVaultKeyFile(path); err != nil {
+			return err
+		}
+		if key, err = readVaultKeyFile(path); err != nil {
+			return err
+		}
+		vault = CredentialVault{KDF: CredentialVaultKeyFile, KeyFile: path}
+	} else {
+		if passphrase == "" {
+			return errors.New("passphrase cannot be empty")
+		}
+		salt := make([]byte, vaultSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		vault = CredentialVault{KDF: CredentialVaultPassphrase, Salt: base64.StdEncoding.EncodeToString(salt)}
+		var err error
+		if key, err = passphraseVaultKey(passphrase, vault.Salt); err != nil {
+			return err
+		}
+	}
+
+	previousVault, previousKey := AppConfig.CredentialVault, vaultKey
+	AppConfig.CredentialVault, vaultKey = vault, key
+	if err := saveAppConfig(); err != nil {
+		AppConfig.CredentialVault, vaultKey = previousVault, previousKey
+		return err
+	}
+	return nil
+}
+
+// DecryptCredentials removes the vault and stores the credentials in plain
+// text again.
+func DecryptCredentials() error {
+	if !CredentialsEncrypted() {
+		return errors.New("credentials are not encrypted")
+	}
+	if !CredentialsAvailable() {
+		return ErrCredentialsLocked
+	}
+	previousVault, previousKey := AppConfig.CredentialVault, vaultKey
+	AppConfig.CredentialVault, vaultKey = CredentialVault{}, nil
+	if err := saveAppConfig(); err != nil {
+		AppConfig.CredentialVault, vaultKey = previousVault, previousKey
+		return err
+	}
+	return nil
+}
+
+// sealCredentialVault returns c as it is written to the config file. With an
+// open vault the credentials are encrypted again. A closed one is left as it
+// was loaded, since AddCredentials and RemoveCredentials refuse to change the
+// credentials until it is opened.
+func sealCredentialVault(c Config) (Config, error) {
+	if !CredentialsEncrypted() || vaultKey == nil {
+		return c, nil
+	}
+	ciphertext, err := encryptCredentials(c.Credentials, vaultKey)
+	if err != nil {
+		return c, err
+	}
+	AppConfig.CredentialVault.Ciphertext = ciphertext
+	c.CredentialVault.Ciphertext = ciphertext
+	c.Credentials = nil
+	return c, nil
+}
+
+func encryptCredentials(credentials []string, key []byte) (string, error) {
+	if credentials == nil {
+		credentials = []string{}
+	}
+	plaintext, err := json.Marshal(credentials)
+	if err != nil {
+		return "", err
+	}
+	cipher, err := subtle.NewAESGCM(key)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := cipher.Encrypt(plaintext, credentialVaultAssociatedData)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func decryptCredentials(encoded string, key []byte) ([]string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential vault: %w", err)
+	}
+	cipher, err := subtle.NewAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := cipher.Decrypt(ciphertext, credentialVaultAssociatedData)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or key file")
+	}
+	var credentials []string
+	if err := json.Unmarshal(plaintext, &credentials); err != nil {
+		return nil, fmt.Errorf("invalid credential vault: %w", err)
+	}
+	return credentials, nil
+}
+
+func passphraseVaultKey(passphrase string, encodedSalt string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(encodedSalt)
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("invalid credential vault salt")
+	}
+	return argon2.IDKey([]byte(passphrase), salt, vaultArgonTime, vaultArgonMemory, vaultArgonThreads, vaultKeySize), nil
+}
+
+// readVaultKeyFile derives the vault key from the contents of path, which can
+// be any file with enough entropy.
+func readVaultKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(data) < minKeyFileSize {
+		return nil, fmt.Errorf("key file %s is shorter than %d bytes", path, minKeyFileSize)
+	}
+	key := sha256.Sum256(append([]byte("gotohp key file\x00"), data...))
+	return key[:], nil
+}
+
+// createVaultKeyFile writes a random key to path unless it already exists.
+func createVaultKeyFile(path string) error {
+	key := make([]byte, vaultKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %w", err)
+	}
+	if _, err := file.Write(key); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	return file.Close()
+}
+
+func credentialEmail(cred string) string {
+	params, err := url.ParseQuery(cred)
+	if err != nil {
+		return ""
+	}
+	return params.Get("Email")
+}
+
+func containsCredentialFor(credentials []string, email string) bool {
+	if email == "" {
+		return false
+	}
+	for _, cred := range credentials {
+		if credentialEmail(cred) == email {
+			return true
+		}
+	}
+	return false
+}
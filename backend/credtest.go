@@ -0,0 +1,127 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Problems reported by TestCredential.
+const (
+	CredentialProblemInvalid        = "invalid"
+	CredentialProblemRevoked        = "revoked"
+	CredentialProblemBindingMissing = "binding-missing"
+	CredentialProblemBindingFailed  = "binding-failed"
+	CredentialProblemNetwork        = "network"
+	CredentialProblemProxy          = "proxy"
+	CredentialProblemPhotos         = "photos-rejected"
+	CredentialProblemUnknown        = "unknown"
+)
+
+// CredentialTestResult is the outcome of TestCredential. Problem is empty
+// when the credential works.
+type CredentialTestResult struct {
+	Email                  string    `json:"email"`
+	TokenBindingNeeded     bool      `json:"tokenBindingNeeded"`
+	TokenBindingConfigured bool      `json:"tokenBindingConfigured"`
+	TokenExpiry            time.Time `json:"tokenExpiry,omitzero"`
+	AuthOK                 bool      `json:"authOk"`
+	ProbeOK                bool      `json:"probeOk"`
+	Problem                string    `json:"problem,omitempty"`
+	Error                  string    `json:"error,omitempty"`
+}
+
+// credentialProbeHash is looked up in the library to check that the token is
+// accepted by Google Photos. It is the SHA-1 of a fixed string, so it never
+// matches real media and the probe changes nothing.
+var credentialProbeHash = sha1.Sum([]byte("gotohp credential probe"))
+
+// TestCredential signs in with the stored credential of email, decrypting a
+// bound token where needed, and looks up a hash in the library. It always
+// performs a fresh auth exchange rather than using a cached token, and keeps
+// the new token for later uploads.
+func TestCredential(email string) CredentialTestResult {
+	result := CredentialTestResult{Email: email}
+	credentials := ""
+	for _, cred := range AppConfig.Credentials {
+		params, err := url.ParseQuery(cred)
+		if err != nil || params.Get("Email") != email {
+			continue
+		}
+		credentials = strings.TrimSpace(cred)
+		result.TokenBindingConfigured = params.Get("token_binding_alias") != ""
+		result.TokenBindingNeeded = result.TokenBindingConfigured || credentialNeedsTokenBinding(params)
+	}
+	if credentials == "" {
+		return result.fail(CredentialProblemInvalid, fmt.Errorf("no credentials found for email %s", email))
+	}
+
+	api, err := NewApi(credentials)
+	if err != nil {
+		problem := classifyCredentialError(err)
+		if errors.Is(err, ErrAuthFailed) {
+			// NewApi signs nothing in; it only rejects a malformed auth string.
+			problem = CredentialProblemInvalid
+		}
+		return result.fail(problem, err)
+	}
+	resp, err := api.getAuthToken()
+	if err != nil {
+		return result.fail(classifyCredentialError(err), err)
+	}
+	if resp["TokenEncrypted"] == "1" {
+		result.TokenBindingNeeded = true
+	}
+	token, err := bearerTokenFromAuthResponse(resp)
+	if err != nil {
+		return result.fail(CredentialProblemUnknown, err)
+	}
+	result.AuthOK = true
+	result.TokenExpiry = time.Unix(token.Expiry, 0)
+	bearerTokens.put(api.authData, token)
+
+	if _, err := api.FindRemoteMediaByHash(context.Background(), credentialProbeHash[:]); err != nil {
+		problem := classifyCredentialError(err)
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden) {
+			problem = CredentialProblemPhotos
+		}
+		return result.fail(problem, err)
+	}
+	result.ProbeOK = true
+	return result
+}
+
+func (r CredentialTestResult) fail(problem string, err error) CredentialTestResult {
+	r.Problem = problem
+	r.Error = err.Error()
+	return r
+}
+
+// classifyCredentialError maps a failed request to the problem a user can act
+// on.
+func classifyCredentialError(err error) string {
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, errTokenBindingMissing):
+		return CredentialProblemBindingMissing
+	case errors.As(err, &tokenBindingError{}):
+		return CredentialProblemBindingFailed
+	case errors.Is(err, ErrAuthFailed):
+		return CredentialProblemRevoked
+	case AppConfig.Proxy != "" && (errors.As(err, &opErr) && opErr.Op == "proxyconnect" || strings.Contains(err.Error(), "proxy")):
+		return CredentialProblemProxy
+	}
+	var netErr net.Error
+	var urlErr *url.Error
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) {
+		return CredentialProblemNetwork
+	}
+	return CredentialProblemUnknown
+}
@@ -0,0 +1,497 @@
+package backend
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type UploadJobStatus string
+
+const (
+	UploadJobQueued    UploadJobStatus = "queued"
+	UploadJobRunning   UploadJobStatus = "running"
+	UploadJobCompleted UploadJobStatus = "completed"
+	UploadJobCancelled UploadJobStatus = "cancelled"
+)
+
+// UploadJob is one batch of paths submitted to the daemon. Jobs run one at a
+// time, in submission order, through the shared UploadManager.
+type UploadJob struct {
+	ID         string             `json:"id"`
+	Paths      []string           `json:"paths"`
+	Album      string             `json:"album,omitempty"`
+	Account    string             `json:"account,omitempty"`
+	Status     UploadJobStatus    `json:"status"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	StartedAt  *time.Time         `json:"startedAt,omitempty"`
+	FinishedAt *time.Time         `json:"finishedAt,omitempty"`
+	Total      int                `json:"total"`
+	Succeeded  int                `json:"succeeded"`
+	Failed     int                `json:"failed"`
+	Skipped    int                `json:"skipped"`
+	Results    []FileUploadResult `json:"results,omitempty"`
+}
+
+// UploadJobRequest is the body of POST /api/jobs. Omitting Album keeps the
+// daemon's configured album, an empty string disables albums and "AUTO"
+// creates albums from folder names. Account selects the account by email or
+// a unique part of it, in place of the routes; omitting it keeps the daemon's
+// account.
+type UploadJobRequest struct {
+	Paths   []string `json:"paths"`
+	Album   *string  `json:"album,omitempty"`
+	Account string   `json:"account,omitempty"`
+}
+
+// Daemon serves the local HTTP control API on top of one UploadManager.
+type Daemon struct {
+	app     *DaemonApp
+	manager *UploadManager
+
+	mu           sync.Mutex
+	jobs         []*UploadJob
+	nextID       int
+	wake         chan struct{}
+	defaultAlbum string
+	defaultAuto  bool
+	// defaultAccount is the --account of the daemon, used by jobs that do not
+	// name one. Without either, jobs follow the routes and the selection.
+	defaultAccount string
+	// token is the bearer token every request must carry, if not empty.
+	token string
+	// listenHost is the host part of the address passed to Serve.
+	listenHost string
+}
+
+// NewDaemon returns a daemon for app. A non-empty token is required as a
+// bearer token on every request.
+func NewDaemon(app *DaemonApp, token string) *Daemon {
+	albumName, autoMode := GetAlbumConfig()
+	d := &Daemon{
+		app:            app,
+		manager:        NewUploadManager(app),
+		wake:           make(chan struct{}, 1),
+		defaultAlbum:   albumName,
+		defaultAuto:    autoMode,
+		defaultAccount: AppConfig.Account,
+		token:          token,
+	}
+	app.mu.Lock()
+	app.onEvent = d.handleEvent
+	app.mu.Unlock()
+	return d
+}
+
+// Serve listens on addr until ctx is cancelled, then cancels the running job
+// and shuts the server down.
+func (d *Daemon) Serve(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	d.listenHost, _, _ = net.SplitHostPort(addr)
+	d.app.GetLogger().Info(fmt.Sprintf("daemon listening on http://%s", listener.Addr()))
+
+	server := &http.Server{
+		Handler:           d.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	runnerDone := make(chan struct{})
+	go func() {
+		d.runJobs(ctx)
+		close(runnerDone)
+	}()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		d.manager.Cancel()
+		<-runnerDone
+		return err
+	case <-ctx.Done():
+	}
+
+	d.manager.Cancel()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	<-runnerDone
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	return err
+}
+
+// Handler returns the HTTP API:
+//
+//	POST   /api/jobs       enqueue paths, body UploadJobRequest
+//	GET    /api/jobs       list jobs, newest last
+//	GET    /api/jobs/{id}  one job including its results
+//	DELETE /api/jobs/{id}  cancel a queued or running job
+//	GET    /api/events     Server-Sent Events stream of engine events
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/jobs", d.handleCreateJob)
+	mux.HandleFunc("GET /api/jobs", d.handleListJobs)
+	mux.HandleFunc("GET /api/jobs/{id}", d.handleGetJob)
+	mux.HandleFunc("DELETE /api/jobs/{id}", d.handleCancelJob)
+	mux.HandleFunc("GET /api/events", d.handleEvents)
+	return d.guard(mux)
+}
+
+// guard rejects requests that a web page in the user's browser could send.
+// A page on another site can reach the API under its own host name through
+// DNS rebinding, so only the listen host, localhost and, when listening on
+// all interfaces, IP addresses are accepted as Host. The token, when set,
+// must be sent as "Authorization: Bearer <token>".
+func (d *Daemon) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !d.allowedHost(r.Host) {
+			writeJSONError(w, http.StatusForbidden, fmt.Sprintf("host %q is not allowed", r.Host))
+			return
+		}
+		if d.token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSONError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (d *Daemon) allowedHost(hostPort string) bool {
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host = strings.Trim(hostPort, "[]")
+	}
+	if strings.EqualFold(host, "localhost") || strings.EqualFold(host, d.listenHost) {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	listenIP := net.ParseIP(d.listenHost)
+	return d.listenHost == "" || (listenIP != nil && listenIP.IsUnspecified())
+}
+
+func (d *Daemon) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	// Browsers send text/plain and form posts to other sites without asking
+	// first, so only JSON is accepted.
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+	var request UploadJobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if len(request.Paths) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "at least one path is required")
+		return
+	}
+	for _, path := range request.Paths {
+		if _, err := os.Stat(path); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid upload path %q: %v", path, err))
+			return
+		}
+	}
+
+	account := d.defaultAccount
+	if request.Account != "" {
+		var err error
+		if account, err = MatchAccount(request.Account); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	d.mu.Lock()
+	d.nextID++
+	job := &UploadJob{
+		ID:        strconv.Itoa(d.nextID),
+		Paths:     request.Paths,
+		Account:   account,
+		Status:    UploadJobQueued,
+		CreatedAt: time.Now(),
+	}
+	if request.Album != nil {
+		job.Album = strings.TrimSpace(*request.Album)
+	} else if d.defaultAuto {
+		job.Album = "AUTO"
+	} else {
+		job.Album = d.defaultAlbum
+	}
+	d.jobs = append(d.jobs, job)
+	snapshot := *job
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	d.app.EmitEvent("jobQueued", snapshot)
+	writeJSON(w, http.StatusCreated, snapshot)
+}
+
+func (d *Daemon) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	jobs := make([]UploadJob, 0, len(d.jobs))
+	for _, job := range d.jobs {
+		summary := *job
+		summary.Results = nil
+		jobs = append(jobs, summary)
+	}
+	d.mu.Unlock()
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (d *Daemon) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	job := d.findJob(r.PathValue("id"))
+	var snapshot UploadJob
+	if job != nil {
+		snapshot = *job
+		snapshot.Results = slices.Clone(job.Results)
+	}
+	d.mu.Unlock()
+	if job == nil {
+		writeJSONError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+func (d *Daemon) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	job := d.findJob(r.PathValue("id"))
+	if job == nil {
+		d.mu.Unlock()
+		writeJSONError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	switch job.Status {
+	case UploadJobQueued:
+		now := time.Now()
+		job.Status = UploadJobCancelled
+		job.FinishedAt = &now
+		d.pruneJobs()
+	case UploadJobRunning:
+		// runJobs marks the job cancelled once the manager has stopped.
+		job.Status = UploadJobCancelled
+		d.manager.Cancel()
+	default:
+		d.mu.Unlock()
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("job is already %s", job.Status))
+		return
+	}
+	snapshot := *job
+	snapshot.Results = nil
+	d.mu.Unlock()
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+func (d *Daemon) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	events, unsubscribe := d.app.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// runJobs executes queued jobs one after another until ctx is cancelled.
+func (d *Daemon) runJobs(ctx context.Context) {
+	for {
+		job := d.startNextJob()
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.wake:
+				continue
+			}
+		}
+
+		settings := UploadRunSettings{AlbumName: job.Album, Account: job.Account}
+		if strings.EqualFold(job.Album, "AUTO") {
+			settings.AlbumName, settings.AlbumAutoMode = "", true
+		}
+
+		d.app.setJob(job.ID)
+		d.manager.UploadWithSettings(d.app, job.Paths, settings)
+		d.mu.Lock()
+		// A DELETE that arrived before Upload created its cancel channel
+		// would otherwise be lost.
+		if job.Status == UploadJobCancelled {
+			d.manager.Cancel()
+		}
+		d.mu.Unlock()
+		d.manager.Wait()
+		d.app.setJob("")
+
+		d.mu.Lock()
+		now := time.Now()
+		job.FinishedAt = &now
+		if job.Status == UploadJobRunning {
+			job.Status = UploadJobCompleted
+		}
+		snapshot := *job
+		snapshot.Results = nil
+		d.pruneJobs()
+		d.mu.Unlock()
+		d.app.EmitEvent("jobFinished", snapshot)
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (d *Daemon) startNextJob() *UploadJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, job := range d.jobs {
+		if job.Status == UploadJobQueued {
+			now := time.Now()
+			job.Status = UploadJobRunning
+			job.StartedAt = &now
+			return job
+		}
+	}
+	return nil
+}
+
+// handleEvent keeps the job counters in step with the engine events.
+func (d *Daemon) handleEvent(jobID string, event string, data any) {
+	if jobID == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	job := d.findJob(jobID)
+	if job == nil {
+		return
+	}
+	switch event {
+	case "uploadStart":
+		if start, ok := data.(UploadBatchStart); ok && start.Total > 0 {
+			job.Total = start.Total
+		}
+	case "uploadTotal":
+		if total, ok := data.(UploadBatchTotal); ok {
+			job.Total = total.Total
+		}
+	case "FileStatus":
+		result, ok := data.(FileUploadResult)
+		if !ok {
+			return
+		}
+		switch {
+		case result.IsError:
+			job.Failed++
+		case result.Skipped:
+			job.Skipped++
+		default:
+			job.Succeeded++
+		}
+		job.Results = append(job.Results, result)
+	}
+}
+
+// daemonFinishedJobs is how many finished jobs, with their results, the
+// daemon keeps for the API. Older ones are forgotten so that a long-running
+// daemon does not grow without bound; the history command still has them.
+const daemonFinishedJobs = 100
+
+// pruneJobs drops the oldest finished jobs beyond daemonFinishedJobs. d.mu
+// must be held.
+func (d *Daemon) pruneJobs() {
+	finished := 0
+	for _, job := range d.jobs {
+		if job.FinishedAt != nil {
+			finished++
+		}
+	}
+	d.jobs = slices.DeleteFunc(d.jobs, func(job *UploadJob) bool {
+		if finished <= daemonFinishedJobs || job.FinishedAt == nil {
+			return false
+		}
+		finished--
+		return true
+	})
+}
+
+func (d *Daemon) findJob(id string) *UploadJob {
+	for _, job := range d.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,81 @@
+package backend
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// DaemonEvent is one engine event as delivered to daemon subscribers.
+type DaemonEvent struct {
+	JobID string `json:"jobId,omitempty"`
+	Event string `json:"event"`
+	Data  any    `json:"data,omitempty"`
+}
+
+// DaemonApp implements AppInterface for the headless daemon. Events are
+// fanned out to subscribers instead of a window or a terminal.
+type DaemonApp struct {
+	logger      *slog.Logger
+	mu          sync.Mutex
+	jobID       string
+	onEvent     func(jobID string, event string, data any)
+	subscribers map[chan DaemonEvent]struct{}
+}
+
+func NewDaemonApp(logLevel slog.Level) *DaemonApp {
+	return &DaemonApp{
+		logger: slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+			Level: logLevel,
+		})),
+		subscribers: make(map[chan DaemonEvent]struct{}),
+	}
+}
+
+func (d *DaemonApp) EmitEvent(event string, data any) {
+	d.mu.Lock()
+	jobID := d.jobID
+	onEvent := d.onEvent
+	message := DaemonEvent{JobID: jobID, Event: event, Data: data}
+	for subscriber := range d.subscribers {
+		select {
+		case subscriber <- message:
+		default:
+			// A slow client must not stall the upload workers.
+		}
+	}
+	d.mu.Unlock()
+
+	if onEvent != nil {
+		onEvent(jobID, event, data)
+	}
+}
+
+func (d *DaemonApp) GetLogger() *slog.Logger {
+	return d.logger
+}
+
+// Subscribe returns a channel receiving every event emitted from now on and a
+// function that unsubscribes and closes it.
+func (d *DaemonApp) Subscribe() (<-chan DaemonEvent, func()) {
+	events := make(chan DaemonEvent, 256)
+	d.mu.Lock()
+	d.subscribers[events] = struct{}{}
+	d.mu.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			d.mu.Lock()
+			delete(d.subscribers, events)
+			d.mu.Unlock()
+			close(events)
+		})
+	}
+}
+
+func (d *DaemonApp) setJob(jobID string) {
+	d.mu.Lock()
+	d.jobID = jobID
+	d.mu.Unlock()
+}
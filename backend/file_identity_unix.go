@@ -0,0 +1,26 @@
+//go:build !windows
+
+package backend
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode number, which changes when a file is replaced
+// by a rename even if its size and mtime are preserved.
+func fileInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
+
+// fileDeviceInode returns the device and inode numbers, which together
+// identify a file however it was reached.
+func fileDeviceInode(info os.FileInfo) (uint64, uint64, bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev), uint64(stat.Ino), true
+	}
+	return 0, 0, false
+}
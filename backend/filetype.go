@@ -0,0 +1,258 @@
+package backend
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLength covers the two MPEG-TS sync bytes at 188 and 376 and the
+// Matroska DocType, which sits in the first few dozen bytes.
+const sniffLength = 512
+
+// tiffRawFormats share the plain TIFF header, so the extension decides which
+// RAW format a TIFF-structured file is.
+var tiffRawFormats = map[string]bool{
+	"nef": true, "arw": true, "dng": true, "pef": true, "sr2": true,
+}
+
+// unsignedFormats are supported formats that detectMediaFormat has no
+// signature for, so their extension is trusted.
+var unsignedFormats = map[string]bool{
+	"ico": true, "mmv": true,
+}
+
+// SkipCodeUnrecognizedContent is reported for a file whose extension names a
+// supported format but whose content is not media gotohp recognizes, such as
+// a truncated download or an HTML error page saved as .jpg.
+const SkipCodeUnrecognizedContent = "unrecognized-content"
+
+// sidecarFormats are companion files that often contain a JPEG or MP4 stream,
+// such as camera thumbnails and low-resolution proxies. They are never typed
+// by content, so they are not uploaded next to the original.
+var sidecarFormats = map[string]bool{
+	"thm": true, "lrv": true, "aae": true, "xmp": true,
+}
+
+// sniffMediaFormat returns the supportedFormats key that matches the content
+// of path, or "" when the content is not recognized. The error is set when
+// the header cannot be read.
+func sniffMediaFormat(path string) (string, error) {
+	if sidecarFormats[extensionFormat(path)] {
+		return "", nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return detectMediaFormat(header[:n], extensionFormat(path)), nil
+}
+
+// detectMediaFormat inspects magic bytes. extFormat is only used to tell TIFF
+// based RAW formats apart.
+func detectMediaFormat(header []byte, extFormat string) string {
+	has := func(offset int, magic string) bool {
+		return len(header) >= offset+len(magic) && string(header[offset:offset+len(magic)]) == magic
+	}
+
+	switch {
+	case has(0, "\xFF\xD8\xFF"):
+		return "jpg"
+	case has(0, "\x89PNG\r\n\x1A\n"):
+		return "png"
+	case has(0, "GIF87a"), has(0, "GIF89a"):
+		return "gif"
+	case has(0, "BM") && has(6, "\x00\x00\x00\x00"):
+		return "bmp"
+	case has(0, "RIFF") && has(8, "WEBP"):
+		return "webp"
+	case has(0, "RIFF") && has(8, "AVI "):
+		return "avi"
+	case has(0, "FUJIFILMCCD-RAW"):
+		return "raf"
+	case has(0, "IIRO"), has(0, "IIRS"), has(0, "MMOR"):
+		return "orf"
+	case has(0, "IIU\x00"):
+		return "rw2"
+	case has(0, "II*\x00") && has(8, "CR\x02"):
+		return "cr2"
+	case has(0, "II*\x00"), has(0, "MM\x00*"):
+		if tiffRawFormats[extFormat] {
+			return extFormat
+		}
+		return "tif"
+	case has(4, "ftyp"):
+		return isoBrandFormat(header)
+	case has(4, "moov"), has(4, "mdat"), has(4, "wide"), has(4, "free"), has(4, "skip"):
+		// QuickTime files written without an ftyp box.
+		return "mov"
+	case has(0, "\x1A\x45\xDF\xA3"):
+		if bytes.Contains(header, []byte("webm")) {
+			return "webm"
+		}
+		return "mkv"
+	case has(0, "\x30\x26\xB2\x75\x8E\x66\xCF\x11"):
+		if extFormat == "asf" {
+			return "asf"
+		}
+		return "wmv"
+	case has(0, "\x00\x00\x01\xBA"):
+		return "mpg"
+	case has(0, "G") && has(188, "G") && has(376, "G"):
+		return "ts"
+	case has(4, "G") && has(196, "G") && has(388, "G"):
+		return "m2ts"
+	}
+	return ""
+}
+
+// isoBrandFormat maps the major and compatible brands of an ISO base media
+// file (HEIF, AVIF, MP4, QuickTime, 3GPP, CR3) to a format. Audio-only files
+// such as M4A and audiobooks return "".
+func isoBrandFormat(header []byte) string {
+	boxSize := int(header[0])<<24 | int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+	end := min(max(boxSize, 16), len(header))
+	brands := []string{}
+	for offset := 8; offset+4 <= end; offset += 4 {
+		if offset == 12 {
+			continue // minor version
+		}
+		brands = append(brands, string(header[offset:offset+4]))
+	}
+	if len(brands) == 0 {
+		return ""
+	}
+
+	hasBrand := func(candidates ...string) bool {
+		for _, brand := range brands {
+			for _, candidate := range candidates {
+				if brand == candidate {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	switch major := brands[0]; {
+	case major == "M4A ", major == "M4B ", major == "M4P ", major == "F4A ":
+		return ""
+	case major == "crx ":
+		return "cr3"
+	case major == "qt  ":
+		return "mov"
+	case major == "avif", major == "avis":
+		return "avif"
+	case hasBrand("heic", "heix", "heim", "heis", "hevc", "hevx"):
+		return "heic"
+	case hasBrand("mif1", "msf1"):
+		if hasBrand("avif") {
+			return "avif"
+		}
+		return "heif"
+	case strings.HasPrefix(major, "3g2"):
+		return "3g2"
+	case strings.HasPrefix(major, "3gp"), strings.HasPrefix(major, "3ge"), strings.HasPrefix(major, "3gg"):
+		return "3gp"
+	case major == "M4V ", major == "M4VH", major == "M4VP":
+		return "m4v"
+	default:
+		return "mp4"
+	}
+}
+
+// extensionFormat returns the lower-case extension of path without the dot.
+func extensionFormat(path string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+}
+
+// mediaFormat prefers the detected content and falls back to the extension
+// only for formats that have no reliable signature. A file whose content
+// contradicts a signed extension returns "".
+func mediaFormat(path string) string {
+	format, _ := scanMediaFormat(path)
+	return format
+}
+
+// scanMediaFormat is mediaFormat that also reports whether the content was
+// read, so that an unreadable file is not mistaken for one that is not
+// media.
+func scanMediaFormat(path string) (string, bool) {
+	format, err := sniffMediaFormat(path)
+	if format != "" {
+		return format, true
+	}
+	if unsignedFormats[extensionFormat(path)] {
+		return extensionFormat(path), true
+	}
+	return "", err == nil
+}
+
+// mediaFormats holds the mediaFormat of the files of a scan by path, so that
+// each file's header is read once for filtering, preflight checks, Live Photo
+// pairing and the commit name.
+type mediaFormats map[string]string
+
+// of returns the format of path, detecting it when the scan did not.
+func (f mediaFormats) of(path string) string {
+	if format, ok := f[path]; ok {
+		return format
+	}
+	return mediaFormat(path)
+}
+
+// uploadFileName returns the name sent when committing a file called name
+// whose mediaFormat is format. When the content does not match the extension,
+// the extension is corrected so that the library does not mislabel the item:
+// IMG_1.JPG_original becomes IMG_1.jpg, an extensionless export gains one and
+// a PNG named .jpg becomes .png.
+func uploadFileName(name string, format string) string {
+	if format == "" {
+		return name
+	}
+	ext := filepath.Ext(name)
+	current := strings.ToLower(strings.TrimPrefix(ext, "."))
+	if sameMediaFormat(current, format) {
+		return name
+	}
+	stem := name
+	// Only replace extensions that look like media extensions, possibly with a
+	// suffix, so names like "Scan 1.5" keep their text.
+	knownPrefix, _, _ := strings.Cut(current, "_")
+	if _, known := supportedFormats[knownPrefix]; known && ext != "" {
+		stem = strings.TrimSuffix(name, ext)
+	}
+	return stem + "." + format
+}
+
+func sameMediaFormat(ext string, format string) bool {
+	switch format {
+	case "jpg":
+		return ext == "jpg" || ext == "jpeg"
+	case "tif":
+		return ext == "tif" || ext == "tiff"
+	case "heic", "heif":
+		return ext == "heic" || ext == "heif"
+	case "mpg":
+		return ext == "mpg" || ext == "mpeg" || ext == "mod" || ext == "tod"
+	case "m2ts":
+		return ext == "m2ts" || ext == "mts" || ext == "m2t"
+	case "mp4":
+		// MP4 brands are shared by many containers with their own extension.
+		return ext == "mp4" || ext == "m4v" || ext == "mov" || ext == "3gp" || ext == "3g2"
+	case "wmv":
+		return ext == "wmv" || ext == "asf"
+	case "mov":
+		return ext == "mov" || ext == "mp4"
+	case "mkv":
+		return ext == "mkv" || ext == "webm"
+	}
+	return ext == format
+}
@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// isoHeader returns an ftyp box with the major brand and compatible brands.
+func isoHeader(major string, compatible ...string) []byte {
+	size := 16 + 4*len(compatible)
+	header := []byte{0, 0, 0, byte(size)}
+	header = append(header, "ftyp"+major+"\x00\x00\x00\x00"...)
+	for _, brand := range compatible {
+		header = append(header, brand...)
+	}
+	return header
+}
+
+// transportStream returns a header with sync bytes every packetSize bytes
+// after prefix bytes of timecode.
+func transportStream(prefix int, packetSize int) []byte {
+	header := make([]byte, sniffLength)
+	for offset := prefix; offset < len(header); offset += packetSize {
+		header[offset] = 'G'
+	}
+	return header
+}
+
+func TestDetectMediaFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    []byte
+		extFormat string
+		want      string
+	}{
+		{"jpeg", []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF"), "", "jpg"},
+		{"png", []byte("\x89PNG\r\n\x1A\n\x00\x00\x00\x0DIHDR"), "jpg", "png"},
+		{"gif87a", []byte("GIF87a\x01\x00"), "", "gif"},
+		{"gif89a", []byte("GIF89a\x01\x00"), "", "gif"},
+		{"bmp", []byte("BM\x36\x00\x0C\x00\x00\x00\x00\x00\x36\x00"), "", "bmp"},
+		{"bmp without reserved zeros", []byte("BM\x36\x00\x0C\x00\x01\x00\x00\x00"), "", ""},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "", "webp"},
+		{"avi", []byte("RIFF\x24\x00\x00\x00AVI LIST"), "", "avi"},
+		{"riff audio", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "", ""},
+		{"raf", []byte("FUJIFILMCCD-RAW 0201"), "", "raf"},
+		{"orf", []byte("IIRO\x08\x00\x00\x00"), "", "orf"},
+		{"rw2", []byte("IIU\x00\x18\x00\x00\x00"), "", "rw2"},
+		{"cr2", []byte("II*\x00\x10\x00\x00\x00CR\x02\x00"), "", "cr2"},
+		{"tiff little endian", []byte("II*\x00\x08\x00\x00\x00"), "", "tif"},
+		{"tiff big endian", []byte("MM\x00*\x00\x00\x00\x08"), "tiff", "tif"},
+		{"nef by extension", []byte("MM\x00*\x00\x00\x00\x08"), "nef", "nef"},
+		{"dng by extension", []byte("II*\x00\x08\x00\x00\x00"), "dng", "dng"},
+		{"heic", isoHeader("heic", "mif1", "heic"), "", "heic"},
+		{"heif", isoHeader("mif1", "mif1"), "", "heif"},
+		{"avif major", isoHeader("avif", "mif1", "avif"), "", "avif"},
+		{"avif compatible", isoHeader("mif1", "mif1", "avif"), "", "avif"},
+		{"mp4", isoHeader("isom", "isom", "mp41"), "", "mp4"},
+		{"mov", isoHeader("qt  ", "qt  "), "mp4", "mov"},
+		{"m4v", isoHeader("M4V ", "M4V ", "mp42"), "", "m4v"},
+		{"3gp", isoHeader("3gp5", "3gp5"), "", "3gp"},
+		{"3g2", isoHeader("3g2a", "3g2a"), "", "3g2"},
+		{"cr3", isoHeader("crx ", "crx "), "", "cr3"},
+		{"m4a audio", isoHeader("M4A ", "M4A ", "mp42"), "mp4", ""},
+		{"ftyp without brands", []byte("\x00\x00\x00\x08ftyp"), "", ""},
+		{"quicktime without ftyp", []byte("\x00\x00\x00\x08wide\x00\x00\x00\x00mdat"), "", "mov"},
+		{"mkv", []byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x88matroska"), "", "mkv"},
+		{"webm", []byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x84webm"), "mkv", "webm"},
+		{"wmv", []byte("\x30\x26\xB2\x75\x8E\x66\xCF\x11\xA6\xD9"), "", "wmv"},
+		{"asf by extension", []byte("\x30\x26\xB2\x75\x8E\x66\xCF\x11\xA6\xD9"), "asf", "asf"},
+		{"mpeg program stream", []byte("\x00\x00\x01\xBA\x44\x00"), "mod", "mpg"},
+		{"mpeg transport stream", transportStream(0, 188), "", "ts"},
+		{"bdav transport stream", transportStream(4, 192), "mts", "m2ts"},
+		{"html", []byte("<!DOCTYPE html><html>"), "jpg", ""},
+		{"empty", nil, "jpg", ""},
+		{"truncated jpeg signature", []byte("\xFF\xD8"), "jpg", ""},
+	}
+	for _, test := range tests {
+		if got := detectMediaFormat(test.header, test.extFormat); got != test.want {
+			t.Errorf("%s: detectMediaFormat = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestScanMediaFormat(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name       string
+		content    string
+		wantFormat string
+		wantRead   bool
+	}{
+		{"photo.jpg", "\xFF\xD8\xFF\xE0", "jpg", true},
+		{"IMG_1.JPG_original", "\xFF\xD8\xFF\xE0", "jpg", true},
+		{"misnamed.jpg", "\x89PNG\r\n\x1A\n", "png", true},
+		{"error-page.jpg", "<html></html>", "", true},
+		{"empty.mp4", "", "", true},
+		{"icon.ico", "\x00\x00\x01\x00", "ico", true},
+		{"thumb.thm", "\xFF\xD8\xFF\xE0", "", true},
+		{"notes.txt", "hello", "", true},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if err := os.WriteFile(path, []byte(test.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		format, read := scanMediaFormat(path)
+		if format != test.wantFormat || read != test.wantRead {
+			t.Errorf("scanMediaFormat(%s) = %q, %v, want %q, %v", test.name, format, read, test.wantFormat, test.wantRead)
+		}
+	}
+
+	if format, read := scanMediaFormat(filepath.Join(dir, "missing.jpg")); format != "" || read {
+		t.Errorf("scanMediaFormat(missing.jpg) = %q, %v, want \"\", false", format, read)
+	}
+}
@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// hashFileWithCache returns the SHA-1 of filePath, reusing the value recorded
+// by an earlier run when the file's size, mtime and inode are unchanged. The
+// hash depends on the content alone, so every account shares the entry. Only
+// the hashing is skipped: callers still check the library of their account.
+// AppConfig.Rehash bypasses the lookup but still refreshes the cache.
+func hashFileWithCache(ctx context.Context, filePath string, info os.FileInfo) ([]byte, error) {
+	if !AppConfig.Rehash {
+		if hash, ok := lookupHashCache(filePath, info); ok {
+			return hash, nil
+		}
+	}
+
+	hash, err := CalculateSHA1(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	storeHashCache(filePath, info, hash)
+	return hash, nil
+}
+
+func lookupHashCache(filePath string, info os.FileInfo) ([]byte, bool) {
+	db, err := openStateDB()
+	if err != nil {
+		return nil, false
+	}
+	var (
+		size  int64
+		mtime int64
+		inode int64
+		hash  []byte
+	)
+	err = db.QueryRow(
+		`SELECT size, mtime_ns, inode, sha1 FROM hash_cache WHERE path = ?`,
+		canonicalUploadPath(filePath),
+	).Scan(&size, &mtime, &inode, &hash)
+	if err != nil {
+		return nil, false
+	}
+	if size != info.Size() || mtime != info.ModTime().UnixNano() || inode != int64(fileInode(info)) {
+		return nil, false
+	}
+	return hash, true
+}
+
+// storeHashCache upserts the cache row.
+func storeHashCache(filePath string, info os.FileInfo, hash []byte) {
+	db, err := openStateDB()
+	if err != nil {
+		return
+	}
+	_, _ = db.Exec(
+		`INSERT OR REPLACE INTO hash_cache (path, size, mtime_ns, inode, sha1, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		canonicalUploadPath(filePath),
+		info.Size(),
+		info.ModTime().UnixNano(),
+		int64(fileInode(info)),
+		hash,
+		time.Now().Unix(),
+	)
+}
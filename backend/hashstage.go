@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// preparedHash is what the hashing stage learned about one file ahead of its
+// upload.
+type preparedHash struct {
+	size    int64
+	modTime time.Time
+	sha1    []byte
+	// remoteKey is the media key of a remote duplicate found by the check.
+	// checked is set when the check ran, with checkErr holding its failure.
+	remoteKey string
+	checked   bool
+	checkErr  error
+}
+
+// preparedHashes holds the hashing stage results of one work item by path. A
+// nil map makes the network stage hash and check files itself.
+type preparedHashes map[string]preparedHash
+
+// lookup returns the prepared result for path unless the file has changed
+// since it was hashed.
+func (p preparedHashes) lookup(path string, info os.FileInfo) (preparedHash, bool) {
+	prepared, ok := p[path]
+	if !ok || prepared.size != info.Size() || !prepared.modTime.Equal(info.ModTime()) {
+		return preparedHash{}, false
+	}
+	return prepared, true
+}
+
+// hash behaves like hashFileWithCache but reuses the hashing stage result.
+func (p preparedHashes) hash(ctx context.Context, path string, info os.FileInfo) ([]byte, error) {
+	if prepared, ok := p.lookup(path, info); ok {
+		return prepared.sha1, nil
+	}
+	return hashFileWithCache(ctx, path, info)
+}
+
+// findRemote returns the result of the hashing stage's remote check, or runs
+// the check now.
+func (p preparedHashes) findRemote(ctx context.Context, api remoteMediaFinder, path string, info os.FileInfo, hash []byte) (string, error) {
+	if prepared, ok := p.lookup(path, info); ok && prepared.checked {
+		return prepared.remoteKey, prepared.checkErr
+	}
+	return api.FindRemoteMediaByHash(ctx, hash)
+}
+
+// prepareUploadWorkItem hashes the files of item and checks them against the
+// library the way the network stage would. Failures are left for the network
+// stage, which repeats the step and reports them with the item.
+func prepareUploadWorkItem(ctx context.Context, api remoteMediaFinder, item UploadWorkItem) preparedHashes {
+	// Force Upload never checks single files; Live Photo pairs always check.
+	check := item.Kind == UploadWorkLivePhoto || !AppConfig.ForceUpload
+	prepared := make(preparedHashes)
+	for _, path := range uploadWorkPaths(item) {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if item.Kind == UploadWorkSingle && hashWhileUploadEligible(item.account, path, info) {
+			continue // read once by the upload itself
+		}
+		hash, err := hashFileWithCache(ctx, path, info)
+		if err != nil {
+			continue
+		}
+		entry := preparedHash{size: info.Size(), modTime: info.ModTime(), sha1: hash}
+		if check {
+			entry.remoteKey, entry.checkErr = api.FindRemoteMediaByHash(ctx, hash)
+			entry.checked = true
+		}
+		prepared[path] = entry
+	}
+	return prepared
+}
+
+// startHashWorker prepares work items for the network workers, so that the
+// next files are read and checked while the current ones are transferring.
+// Items are passed on unprepared once the failure limit is reached.
+func startHashWorker(hashChan <-chan UploadWorkItem, workChan chan<- UploadWorkItem, cancel <-chan struct{}, stop <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ctx, cancelHashing := context.WithCancel(context.Background())
+	defer cancelHashing()
+	go func() {
+		select {
+		case <-cancel:
+			cancelHashing()
+		case <-ctx.Done():
+		}
+	}()
+
+	apis := make(accountApis)
+	for item := range hashChan {
+		select {
+		case <-cancel:
+			return
+		case <-stop:
+		default:
+			if api, err := apis.get(item.account); err == nil {
+				item.hashes = prepareUploadWorkItem(ctx, api, item)
+			}
+		}
+		select {
+		case <-cancel:
+			return
+		case workChan <- item:
+		}
+	}
+}
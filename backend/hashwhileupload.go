@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// hashWhileUploadUnsupported holds the accounts whose upload token requests
+// without a hash the server refused, so the rest of the run does not ask
+// again. It is cleared when a run starts.
+var hashWhileUploadUnsupported sync.Map
+
+// hashWhileUploadEligible reports whether path should be hashed while it is
+// sent. Only files missing from the hash cache qualify: gotohp has never seen
+// them, so they are almost certainly new. Cached files are checked against
+// the library by their cached hash without being read.
+func hashWhileUploadEligible(account string, path string, info os.FileInfo) bool {
+	if !AppConfig.HashWhileUpload {
+		return false
+	}
+	if _, unsupported := hashWhileUploadUnsupported.Load(account); unsupported {
+		return false
+	}
+	if !AppConfig.Rehash {
+		if _, ok := lookupHashCache(path, info); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// uploadFileHashingWhileSending reads the file once, for the transfer and the
+// hash together, and sends the hash with the commit instead of the upload
+// token request. The library is checked after the transfer rather than
+// before, so a duplicate costs bandwidth but is still not committed twice.
+// It returns errUploadHashRequired when the server does not allow this.
+func uploadFileHashingWhileSending(ctx context.Context, api *Api, account string, filePath string, format string, fileInfo os.FileInfo, uploadTimestamp int64, workerID int, callback ProgressCallback) (string, error) {
+	fileName := filepath.Base(filePath)
+	callback("ThreadStatus", ThreadStatus{
+		WorkerID:   workerID,
+		Status:     "uploading",
+		FilePath:   filePath,
+		FileName:   fileName,
+		Message:    "Uploading and hashing...",
+		BytesTotal: fileInfo.Size(),
+	})
+
+	finalizeToken, hash, err := uploadHashingWithResumableSession(ctx, api, account, filePath, fileInfo, uploadProgressCallback(filePath, workerID, callback))
+	if err != nil {
+		if errors.Is(err, errUploadHashRequired) {
+			return "", err
+		}
+		return "", fmt.Errorf("error uploading file: %w", err)
+	}
+	storeHashCache(filePath, fileInfo, hash)
+
+	if !AppConfig.ForceUpload {
+		callback("ThreadStatus", ThreadStatus{
+			WorkerID: workerID,
+			Status:   "checking",
+			FilePath: filePath,
+			FileName: fileName,
+			Message:  "Checking if file exists in library...",
+		})
+		// A failed check is not fatal, as in the two-pass flow.
+		if mediaKey, err := api.FindRemoteMediaByHash(ctx, hash); err == nil && mediaKey != "" {
+			return keepExistingMedia(ctx, api, filePath, hash, mediaKey, workerID, callback)
+		}
+	}
+	return commitUploadedFile(ctx, api, account, filePath, format, fileInfo, hash, finalizeToken, uploadTimestamp, workerID, callback)
+}
+
+// uploadHashingWithResumableSession is uploadWithResumableSession for a file
+// whose hash is not known yet. Its session is persisted with an empty hash,
+// so only another hash-while-upload transfer of the unchanged file resumes it.
+// A resumed transfer reads the part the server already has only to hash it.
+func uploadHashingWithResumableSession(
+	ctx context.Context,
+	api *Api,
+	account string,
+	filePath string,
+	info os.FileInfo,
+	onProgress UploadProgressCallback,
+) (ScottyFinalizeToken, []byte, error) {
+	if uploadID, ok := loadUploadSession(account, filePath, info, []byte{}); ok {
+		token, hash, err := api.ResumeUploadFileHashingWithProgress(ctx, filePath, uploadID, onProgress)
+		if err == nil {
+			deleteUploadSession(account, filePath)
+			return token, hash, nil
+		}
+		if !errors.Is(err, errUploadSessionExpired) {
+			return ScottyFinalizeToken{}, nil, err
+		}
+		deleteUploadSession(account, filePath)
+	}
+
+	uploadID, err := api.GetUploadToken("", info.Size())
+	if err != nil {
+		return ScottyFinalizeToken{}, nil, err
+	}
+	saveUploadSession(account, filePath, info, []byte{}, uploadID)
+
+	token, hash, err := api.UploadFileHashingWithProgress(ctx, filePath, uploadID, onProgress)
+	if err != nil {
+		if errors.Is(err, errUploadSessionExpired) {
+			deleteUploadSession(account, filePath)
+		}
+		return ScottyFinalizeToken{}, nil, err
+	}
+	deleteUploadSession(account, filePath)
+	return token, hash, nil
+}
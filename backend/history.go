@@ -0,0 +1,285 @@
+package backend
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadHistoryEntry is one recorded FileUploadResult from a past run.
+type UploadHistoryEntry struct {
+	ID          int64     `json:"id"`
+	RunID       string    `json:"runId"`
+	Path        string    `json:"path"`
+	Paths       []string  `json:"paths,omitempty"`
+	SHA1        string    `json:"sha1,omitempty"`
+	MediaKey    string    `json:"mediaKey,omitempty"`
+	AlbumKeys   []string  `json:"albumKeys,omitempty"`
+	Account     string    `json:"account,omitempty"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+	IsLivePhoto bool      `json:"isLivePhoto,omitempty"`
+	IsError     bool      `json:"isError,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Skipped     bool      `json:"skipped,omitempty"`
+	SkipCode    string    `json:"skipCode,omitempty"`
+}
+
+// Status summarizes the outcome as "uploaded", "skipped" or "failed".
+func (e UploadHistoryEntry) Status() string {
+	switch {
+	case e.IsError:
+		return "failed"
+	case e.Skipped:
+		return "skipped"
+	default:
+		return "uploaded"
+	}
+}
+
+// UploadRunOptions are the settings that decide how a batch is grouped and
+// where it lands. They are stored per run so a later retry can reproduce them.
+type UploadRunOptions struct {
+	AlbumName                     string `json:"albumName,omitempty"`
+	AlbumAutoMode                 bool   `json:"albumAutoMode,omitempty"`
+	PairLivePhotos                bool   `json:"pairLivePhotos,omitempty"`
+	SkipIncompleteLivePhotos      bool   `json:"skipIncompleteLivePhotos,omitempty"`
+	UpdateExistingPhotosToLive    bool   `json:"updateExistingPhotosToLive,omitempty"`
+	IgnoreAppleMetadata           bool   `json:"ignoreAppleMetadata,omitempty"`
+	DisableUnsupportedFilesFilter bool   `json:"disableUnsupportedFilesFilter,omitempty"`
+}
+
+// CurrentUploadRunOptions snapshots the run options from AppConfig.
+func CurrentUploadRunOptions() UploadRunOptions {
+	return UploadRunOptions{
+		AlbumName:                     AppConfig.AlbumName,
+		AlbumAutoMode:                 AppConfig.AlbumAutoMode,
+		PairLivePhotos:                AppConfig.PairLivePhotos,
+		SkipIncompleteLivePhotos:      AppConfig.SkipIncompleteLivePhotos,
+		UpdateExistingPhotosToLive:    AppConfig.UpdateExistingPhotosToLive,
+		IgnoreAppleMetadata:           AppConfig.IgnoreAppleMetadata,
+		DisableUnsupportedFilesFilter: AppConfig.DisableUnsupportedFilesFilter,
+	}
+}
+
+// historyRecorder writes the results of one UploadManager run. A nil recorder
+// is valid and records nothing, so history never blocks an upload.
+type historyRecorder struct {
+	db      *sql.DB
+	runID   string
+	account string
+}
+
+func newHistoryRecorder(account string, options UploadRunOptions) *historyRecorder {
+	db, err := openStateDB()
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	h := &historyRecorder{
+		db:      db,
+		runID:   strconv.FormatInt(now.UnixNano(), 36),
+		account: account,
+	}
+	optionsJSON, _ := json.Marshal(options)
+	_, _ = db.Exec(
+		`INSERT OR REPLACE INTO upload_runs (run_id, started_at, account, options) VALUES (?, ?, ?, ?)`,
+		h.runID, now.Unix(), account, string(optionsJSON),
+	)
+	return h
+}
+
+func (h *historyRecorder) record(result FileUploadResult) {
+	if h == nil || result.Path == "" {
+		return
+	}
+	paths := result.Paths
+	if len(paths) == 0 {
+		paths = []string{result.Path}
+	}
+	canonicalPaths := make([]string, 0, len(paths))
+	for _, path := range paths {
+		canonicalPaths = append(canonicalPaths, canonicalUploadPath(path))
+	}
+	pathsJSON, _ := json.Marshal(canonicalPaths)
+	errorMessage := result.ErrorMessage
+	if errorMessage == "" && result.Error != nil {
+		errorMessage = result.Error.Error()
+	}
+	// Routed items name their account; the run's account covers the rest.
+	account := result.Account
+	if account == "" {
+		account = h.account
+	}
+	_, _ = h.db.Exec(
+		`INSERT INTO upload_history (run_id, path, paths, sha1, media_key, album_keys, account, uploaded_at, is_live_photo, is_error, error, skipped, skip_code)
+		 VALUES (?, ?, ?, ?, ?, '', ?, ?, ?, ?, ?, ?, ?)`,
+		h.runID,
+		canonicalPaths[0],
+		string(pathsJSON),
+		hex.EncodeToString(result.sha1),
+		result.MediaKey,
+		account,
+		time.Now().Unix(),
+		result.IsLivePhoto,
+		result.IsError,
+		errorMessage,
+		result.Skipped,
+		result.SkipCode,
+	)
+}
+
+// attachAlbumKeys stores the albums that the run's media keys were added to.
+func (h *historyRecorder) attachAlbumKeys(mediaKeys []string, albumKeys []string) {
+	if h == nil || len(mediaKeys) == 0 || len(albumKeys) == 0 {
+		return
+	}
+	albumKeysJSON, _ := json.Marshal(albumKeys)
+	tx, err := h.db.Begin()
+	if err != nil {
+		return
+	}
+	for _, mediaKey := range mediaKeys {
+		if _, err := tx.Exec(
+			`UPDATE upload_history SET album_keys = ? WHERE run_id = ? AND media_key = ?`,
+			string(albumKeysJSON), h.runID, mediaKey,
+		); err != nil {
+			_ = tx.Rollback()
+			return
+		}
+	}
+	_ = tx.Commit()
+}
+
+const uploadHistoryColumns = `id, run_id, path, paths, sha1, media_key, album_keys, account, uploaded_at, is_live_photo, is_error, error, skipped, skip_code`
+
+// ListUploadHistory returns the most recent history entries, newest first.
+func ListUploadHistory(limit int) ([]UploadHistoryEntry, error) {
+	return queryUploadHistory(`SELECT `+uploadHistoryColumns+` FROM upload_history ORDER BY id DESC LIMIT ?`, historyLimit(limit))
+}
+
+// GetUploadHistoryEntry returns a single entry by its numeric ID.
+func GetUploadHistoryEntry(id int64) (UploadHistoryEntry, error) {
+	entries, err := queryUploadHistory(`SELECT `+uploadHistoryColumns+` FROM upload_history WHERE id = ?`, id)
+	if err != nil {
+		return UploadHistoryEntry{}, err
+	}
+	if len(entries) == 0 {
+		return UploadHistoryEntry{}, fmt.Errorf("no history entry with id %d", id)
+	}
+	return entries[0], nil
+}
+
+// UploadHistoryForPath returns every recorded attempt for a local file,
+// including runs where it was one component of a Live Photo.
+func UploadHistoryForPath(path string) ([]UploadHistoryEntry, error) {
+	canonicalPath := canonicalUploadPath(path)
+	pathJSON, _ := json.Marshal(canonicalPath)
+	return queryUploadHistory(
+		`SELECT `+uploadHistoryColumns+` FROM upload_history WHERE path = ? OR instr(paths, ?) > 0 ORDER BY id DESC`,
+		canonicalPath, string(pathJSON),
+	)
+}
+
+// SearchUploadHistory matches query against paths, SHA-1 hex prefixes, media
+// keys, album keys and accounts.
+func SearchUploadHistory(query string, limit int) ([]UploadHistoryEntry, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("search query cannot be empty")
+	}
+	like := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+	return queryUploadHistory(
+		`SELECT `+uploadHistoryColumns+` FROM upload_history
+		 WHERE path LIKE ? ESCAPE '\' OR paths LIKE ? ESCAPE '\' OR sha1 LIKE ? OR media_key = ? OR album_keys LIKE ? ESCAPE '\' OR account LIKE ? ESCAPE '\'
+		 ORDER BY id DESC LIMIT ?`,
+		like, like, strings.ToLower(query)+"%", query, like, like, historyLimit(limit),
+	)
+}
+
+// LatestFailedUploads returns the failed and never-attempted entries of the
+// most recent recorded run together with the options it was started with.
+func LatestFailedUploads() (UploadRunOptions, []UploadHistoryEntry, error) {
+	var options UploadRunOptions
+	db, err := openStateDB()
+	if err != nil {
+		return options, nil, err
+	}
+	var runID string
+	err = db.QueryRow(`SELECT run_id FROM upload_history ORDER BY id DESC LIMIT 1`).Scan(&runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return options, nil, fmt.Errorf("upload history is empty")
+	}
+	if err != nil {
+		return options, nil, fmt.Errorf("query upload history: %w", err)
+	}
+	var optionsJSON string
+	if err := db.QueryRow(`SELECT options FROM upload_runs WHERE run_id = ?`, runID).Scan(&optionsJSON); err == nil && optionsJSON != "" {
+		_ = json.Unmarshal([]byte(optionsJSON), &options)
+	}
+	entries, err := queryUploadHistory(
+		`SELECT `+uploadHistoryColumns+` FROM upload_history WHERE run_id = ? AND (is_error = 1 OR skip_code = ?) ORDER BY id`,
+		runID, SkipCodeMaxFailures,
+	)
+	return options, entries, err
+}
+
+func historyLimit(limit int) int {
+	if limit <= 0 {
+		return -1 // SQLite treats a negative LIMIT as unbounded
+	}
+	return limit
+}
+
+func queryUploadHistory(query string, args ...any) ([]UploadHistoryEntry, error) {
+	db, err := openStateDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query upload history: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries []UploadHistoryEntry
+	for rows.Next() {
+		var (
+			entry      UploadHistoryEntry
+			pathsJSON  string
+			albumsJSON string
+			uploadedAt int64
+		)
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.RunID,
+			&entry.Path,
+			&pathsJSON,
+			&entry.SHA1,
+			&entry.MediaKey,
+			&albumsJSON,
+			&entry.Account,
+			&uploadedAt,
+			&entry.IsLivePhoto,
+			&entry.IsError,
+			&entry.Error,
+			&entry.Skipped,
+			&entry.SkipCode,
+		); err != nil {
+			return nil, fmt.Errorf("read upload history: %w", err)
+		}
+		if pathsJSON != "" {
+			_ = json.Unmarshal([]byte(pathsJSON), &entry.Paths)
+		}
+		if albumsJSON != "" {
+			_ = json.Unmarshal([]byte(albumsJSON), &entry.AlbumKeys)
+		}
+		entry.UploadedAt = time.Unix(uploadedAt, 0)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
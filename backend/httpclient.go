@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -84,8 +85,49 @@ func CheckResponse(resp *http.Response) error {
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		return nil
 	}
+	return newHTTPStatusError(resp)
+}
+
+// httpStatusError is a response outside of 2xx. RetryAfter is the server's
+// Retry-After hint, or zero when it sent none.
+type httpStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Body       string
+}
+
+func newHTTPStatusError(resp *http.Response) *httpStatusError {
 	body, _ := ReadResponseBody(resp)
-	return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	return &httpStatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		Body:       string(body),
+	}
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// throttled reports whether the server is rate limiting or overloaded.
+func (e *httpStatusError) throttled() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// parseRetryAfter accepts both forms of Retry-After, delay seconds and an
+// HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
 }
 
 func ReadResponseBody(resp *http.Response) ([]byte, error) {
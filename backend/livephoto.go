@@ -29,6 +29,15 @@ type UploadWorkItem struct {
 	Kind      UploadWorkKind
 	Single    *SingleMedia
 	LivePhoto *LivePhotoPair
+	// formats are the media formats found by the scan, by path.
+	formats mediaFormats
+	// hashes is filled in by the hashing stage of an upload.
+	hashes preparedHashes
+	// account is the email of the account the item goes to and album the
+	// album of its route, if any. Both are set by the router when the item is
+	// dispatched.
+	account string
+	album   string
 }
 
 type PreflightWarning struct {
@@ -73,13 +82,19 @@ type livePhotoCandidates struct {
 // identifier. The explicit CLI override uses case-insensitive filename stems;
 // it remains one-to-one and still requires valid Live Photo video timing data.
 func ClassifyUploadWork(paths []string, options LivePhotoClassificationOptions, reader LivePhotoMetadataReader) ([]UploadWorkItem, []PreflightWarning) {
+	return classifyUploadWork(paths, nil, options, reader)
+}
+
+// classifyUploadWork is ClassifyUploadWork for scanned paths, whose formats
+// are already known.
+func classifyUploadWork(paths []string, formats mediaFormats, options LivePhotoClassificationOptions, reader LivePhotoMetadataReader) ([]UploadWorkItem, []PreflightWarning) {
 	if !options.Enabled {
 		work := make([]UploadWorkItem, 0, len(paths))
 		for _, path := range paths {
 			if options.Cancelled != nil && options.Cancelled() {
 				return nil, nil
 			}
-			work = append(work, UploadWorkItem{Kind: UploadWorkSingle, Single: &SingleMedia{Path: path}})
+			work = append(work, UploadWorkItem{Kind: UploadWorkSingle, Single: &SingleMedia{Path: path}, formats: formats})
 		}
 		return work, nil
 	}
@@ -93,7 +108,7 @@ func ClassifyUploadWork(paths []string, options LivePhotoClassificationOptions,
 		if options.Cancelled != nil && options.Cancelled() {
 			return nil, nil
 		}
-		switch livePhotoCandidateType(path) {
+		switch livePhotoCandidateType(formats.of(path)) {
 		case "photo":
 			if options.IgnoreAppleMetadata {
 				candidates := candidatesForIdentifier(candidatesByIdentifier, livePhotoFilenameMatchKey(path))
@@ -209,13 +224,13 @@ func ClassifyUploadWork(paths []string, options LivePhotoClassificationOptions,
 		}
 		if pair, ok := pairsByIndex[index]; ok {
 			pair := pair
-			work = append(work, UploadWorkItem{Kind: UploadWorkLivePhoto, LivePhoto: &pair})
+			work = append(work, UploadWorkItem{Kind: UploadWorkLivePhoto, LivePhoto: &pair, formats: formats})
 			continue
 		}
 		if consumed[index] {
 			continue
 		}
-		work = append(work, UploadWorkItem{Kind: UploadWorkSingle, Single: &SingleMedia{Path: path}})
+		work = append(work, UploadWorkItem{Kind: UploadWorkSingle, Single: &SingleMedia{Path: path}, formats: formats})
 	}
 	return work, warnings
 }
@@ -242,11 +257,13 @@ func candidateFirstIndex(candidates *livePhotoCandidates) int {
 	return first
 }
 
-func livePhotoCandidateType(path string) string {
-	switch strings.ToLower(filepath.Ext(path)) {
-	case ".heic", ".heif", ".jpg", ".jpeg":
+// livePhotoCandidateType types a file by its mediaFormat, which follows the
+// content, so renamed or extensionless Live Photo components are still paired.
+func livePhotoCandidateType(format string) string {
+	switch format {
+	case "heic", "heif", "jpg":
 		return "photo"
-	case ".mov":
+	case "mov":
 		return "video"
 	default:
 		return ""
@@ -2,25 +2,30 @@ package backend
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
 )
 
 type livePhotoUploadAPI interface {
-	FindRemoteMediaByHash(hash []byte) (string, error)
-	GetUploadToken(sha1Hash string, fileSize int64) (string, error)
-	UploadFileWithProgress(ctx context.Context, filePath string, uploadToken string, onProgress UploadProgressCallback) (ScottyFinalizeToken, error)
-	CommitLivePhoto(input LivePhotoCreateRequest) (string, error)
-	ReconcileLivePhoto(input LivePhotoReconcileRequest) (string, error)
+	FindRemoteMediaByHash(ctx context.Context, hash []byte) (string, error)
+	resumableUploadAPI
+	CommitLivePhoto(ctx context.Context, input LivePhotoCreateRequest) (string, error)
+	ReconcileLivePhoto(ctx context.Context, input LivePhotoReconcileRequest) (string, error)
 }
 
 type LivePhotoUploadOptions struct {
 	Policy                     LivePhotoCommitPolicy
 	DeleteFromHost             bool
+	DeletePolicy               localDeletePolicy
 	SetDateFromFilename        bool
 	UpdateExistingPhotosToLive bool
+	// account is the account api belongs to, whose hash cache entries are used.
+	account string
+	// formats are the media formats of the scan, by path.
+	formats mediaFormats
+	// hashes are the hashing stage results for the pair, if any.
+	hashes preparedHashes
 }
 
 func uploadLivePhotoWithCallback(
@@ -49,11 +54,11 @@ func uploadLivePhotoWithCallback(
 		Message:  "Hashing Live Photo pair...",
 	})
 
-	photoSHA1, err := CalculateSHA1(ctx, pair.PhotoPath)
+	photoSHA1, err := options.hashes.hash(ctx, pair.PhotoPath, photoInfo)
 	if err != nil {
 		return "", false, fmt.Errorf("hash Live Photo still: %w", err)
 	}
-	videoSHA1, err := CalculateSHA1(ctx, pair.VideoPath)
+	videoSHA1, err := options.hashes.hash(ctx, pair.VideoPath, videoInfo)
 	if err != nil {
 		return "", false, fmt.Errorf("hash Live Photo video: %w", err)
 	}
@@ -65,13 +70,13 @@ func uploadLivePhotoWithCallback(
 		FileName: displayName,
 		Message:  "Checking both Live Photo components...",
 	})
-	photoRemoteKey, photoCheckErr := api.FindRemoteMediaByHash(photoSHA1)
-	videoRemoteKey, videoCheckErr := api.FindRemoteMediaByHash(videoSHA1)
-	if photoCheckErr != nil {
-		return "", false, fmt.Errorf("check Live Photo still deduplication: %w", photoCheckErr)
+	photoRemoteKey, err := options.hashes.findRemote(ctx, api, pair.PhotoPath, photoInfo, photoSHA1)
+	if err != nil {
+		return "", false, fmt.Errorf("check Live Photo still deduplication: %w", err)
 	}
-	if videoCheckErr != nil {
-		return "", false, fmt.Errorf("check Live Photo video deduplication: %w", videoCheckErr)
+	videoRemoteKey, err := options.hashes.findRemote(ctx, api, pair.VideoPath, videoInfo, videoSHA1)
+	if err != nil {
+		return "", false, fmt.Errorf("check Live Photo video deduplication: %w", err)
 	}
 	if photoRemoteKey != "" {
 		if options.UpdateExistingPhotosToLive {
@@ -115,11 +120,11 @@ func uploadLivePhotoWithCallback(
 		return "", true, nil
 	}
 
-	photoToken, err := uploadLivePhotoComponent(ctx, api, pair.PhotoPath, pair.PhotoPath, photoInfo.Size(), photoSHA1, 0, totalBytes, workerID, displayName, callback)
+	photoToken, err := uploadLivePhotoComponent(ctx, api, options.account, pair.PhotoPath, pair.PhotoPath, photoInfo, photoSHA1, 0, totalBytes, workerID, displayName, callback)
 	if err != nil {
 		return "", false, fmt.Errorf("upload Live Photo still: %w", err)
 	}
-	videoToken, err := uploadLivePhotoComponent(ctx, api, pair.VideoPath, pair.PhotoPath, videoInfo.Size(), videoSHA1, photoInfo.Size(), totalBytes, workerID, displayName, callback)
+	videoToken, err := uploadLivePhotoComponent(ctx, api, options.account, pair.VideoPath, pair.PhotoPath, videoInfo, videoSHA1, photoInfo.Size(), totalBytes, workerID, displayName, callback)
 	if err != nil {
 		return "", false, fmt.Errorf("upload Live Photo video: %w", err)
 	}
@@ -137,10 +142,10 @@ func uploadLivePhotoWithCallback(
 		FileName: displayName,
 		Message:  "Committing linked Live Photo...",
 	})
-	mediaKey, err = api.CommitLivePhoto(LivePhotoCreateRequest{
+	mediaKey, err = api.CommitLivePhoto(ctx, LivePhotoCreateRequest{
 		PhotoToken:       photoToken,
 		VideoToken:       videoToken,
-		FileName:         photoInfo.Name(),
+		FileName:         uploadFileName(photoInfo.Name(), options.formats.of(pair.PhotoPath)),
 		PhotoSHA1:        photoSHA1,
 		VideoSHA1:        videoSHA1,
 		CreatedAt:        uploadTime,
@@ -157,7 +162,7 @@ func uploadLivePhotoWithCallback(
 	}
 
 	if options.DeleteFromHost {
-		if err := removeLivePhotoFiles(pair); err != nil {
+		if err := removeLivePhotoFiles(ctx, api, options.DeletePolicy, mediaKey, pair, photoSHA1, videoSHA1); err != nil {
 			return mediaKey, false, err
 		}
 	}
@@ -187,9 +192,10 @@ func reconcileExistingLivePhoto(
 	videoToken, err := uploadLivePhotoComponent(
 		ctx,
 		api,
+		options.account,
 		pair.VideoPath,
 		pair.PhotoPath,
-		videoInfo.Size(),
+		videoInfo,
 		videoSHA1,
 		0,
 		videoInfo.Size(),
@@ -214,9 +220,9 @@ func reconcileExistingLivePhoto(
 		FileName: displayName,
 		Message:  "Updating existing photo to Live...",
 	})
-	mediaKey, err := api.ReconcileLivePhoto(LivePhotoReconcileRequest{
+	mediaKey, err := api.ReconcileLivePhoto(ctx, LivePhotoReconcileRequest{
 		VideoToken:       videoToken,
-		FileName:         videoInfo.Name(),
+		FileName:         uploadFileName(videoInfo.Name(), options.formats.of(pair.VideoPath)),
 		PhotoSHA1:        photoSHA1,
 		VideoSHA1:        videoSHA1,
 		CreatedAt:        uploadTime,
@@ -232,7 +238,7 @@ func reconcileExistingLivePhoto(
 		return "", fmt.Errorf("updated Live Photo media key not received")
 	}
 	if options.DeleteFromHost {
-		if err := removeLivePhotoFiles(pair); err != nil {
+		if err := removeLivePhotoFiles(ctx, api, options.DeletePolicy, mediaKey, pair, photoSHA1, videoSHA1); err != nil {
 			return mediaKey, err
 		}
 	}
@@ -242,9 +248,10 @@ func reconcileExistingLivePhoto(
 func uploadLivePhotoComponent(
 	ctx context.Context,
 	api livePhotoUploadAPI,
+	account string,
 	componentPath string,
 	progressPath string,
-	size int64,
+	info os.FileInfo,
 	hash []byte,
 	completedBytes int64,
 	totalBytes int64,
@@ -252,10 +259,6 @@ func uploadLivePhotoComponent(
 	displayName string,
 	callback ProgressCallback,
 ) (ScottyFinalizeToken, error) {
-	uploadSession, err := api.GetUploadToken(base64.StdEncoding.EncodeToString(hash), size)
-	if err != nil {
-		return ScottyFinalizeToken{}, err
-	}
 	progress := func(bytesUploaded, _ int64, attempt int) {
 		message := "Uploading Live Photo pair..."
 		if attempt > 1 {
@@ -272,7 +275,7 @@ func uploadLivePhotoComponent(
 			Attempt:       attempt,
 		})
 	}
-	return api.UploadFileWithProgress(ctx, componentPath, uploadSession, progress)
+	return uploadWithResumableSession(ctx, api, account, componentPath, info, hash, progress)
 }
 
 func emitLivePhotoStatus(callback ProgressCallback, status ThreadStatus) {
@@ -281,11 +284,13 @@ func emitLivePhotoStatus(callback ProgressCallback, status ThreadStatus) {
 	}
 }
 
-func removeLivePhotoFiles(pair LivePhotoPair) error {
-	for _, path := range []string{pair.VideoPath, pair.PhotoPath} {
-		if err := os.Remove(path); err != nil {
-			return fmt.Errorf("Live Photo uploaded but failed to delete %s: %w", filepath.Base(path), err)
-		}
+func removeLivePhotoFiles(ctx context.Context, api remoteMediaFinder, policy localDeletePolicy, mediaKey string, pair LivePhotoPair, photoSHA1 []byte, videoSHA1 []byte) error {
+	err := removeUploadedFiles(ctx, api, policy, mediaKey,
+		localFile{Path: pair.VideoPath, SHA1: videoSHA1},
+		localFile{Path: pair.PhotoPath, SHA1: photoSHA1},
+	)
+	if err != nil {
+		return fmt.Errorf("Live Photo uploaded but failed to delete local files: %w", err)
 	}
 	return nil
 }
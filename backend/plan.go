@@ -0,0 +1,223 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Plan actions describe what a real upload would do with an item.
+const (
+	PlanActionUpload          = "upload"
+	PlanActionUploadLivePhoto = "upload-live-photo"
+	PlanActionUpdateToLive    = "update-existing-to-live"
+	PlanActionExists          = "exists"
+	PlanActionSkip            = "skip"
+	PlanActionError           = "error"
+)
+
+// UploadPlanItem is the predicted outcome for one upload work item.
+type UploadPlanItem struct {
+	Action      string   `json:"action"`
+	Path        string   `json:"path"`
+	Paths       []string `json:"paths,omitempty"`
+	IsLivePhoto bool     `json:"isLivePhoto,omitempty"`
+	MediaKey    string   `json:"mediaKey,omitempty"`
+	Album       string   `json:"album,omitempty"`
+	Account     string   `json:"account,omitempty"`
+	DeleteLocal bool     `json:"deleteLocal,omitempty"`
+	SkipCode    string   `json:"skipCode,omitempty"`
+	Reason      string   `json:"reason,omitempty"`
+}
+
+// UploadPlan is the result of PlanUpload.
+type UploadPlan struct {
+	Items    []UploadPlanItem   `json:"items"`
+	Warnings []PreflightWarning `json:"warnings,omitempty"`
+}
+
+type remoteMediaFinder interface {
+	FindRemoteMediaByHash(ctx context.Context, shaHash []byte) (string, error)
+}
+
+// PlanUpload runs the read-only part of an upload: filtering, Live Photo
+// classification, hashing and the remote duplicate check. It never requests
+// an upload token, transfers data, commits media, touches albums or deletes
+// files, so it is safe to run before an upload with DeleteFromHost.
+func PlanUpload(ctx context.Context, paths []string) (UploadPlan, error) {
+	cancelled := func() bool { return ctx.Err() != nil }
+	router, err := newAccountRouter(AppConfig.Routes, AppConfig.Account)
+	if err != nil {
+		return UploadPlan{}, err
+	}
+	workItems, warnings, err := collectUploadWork(paths, cancelled)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return UploadPlan{}, ctxErr
+	}
+	if err != nil {
+		return UploadPlan{}, err
+	}
+
+	plan := UploadPlan{Warnings: make([]PreflightWarning, 0, len(warnings))}
+	for _, warning := range warnings {
+		if !IsSkippedPreflightWarning(warning.Code) {
+			plan.Warnings = append(plan.Warnings, warning)
+			continue
+		}
+		primaryPath := ""
+		if len(warning.Paths) > 0 {
+			primaryPath = warning.Paths[0]
+		}
+		plan.Items = append(plan.Items, UploadPlanItem{
+			Action:      PlanActionSkip,
+			Path:        primaryPath,
+			Paths:       warning.Paths,
+			IsLivePhoto: isLivePhotoSkipCode(warning.Code),
+			SkipCode:    warning.Code,
+			Reason:      warning.Message,
+			Account:     router.target(primaryPath).account,
+		})
+	}
+	if len(workItems) == 0 {
+		return plan, nil
+	}
+
+	// Fail like the real upload would when an account cannot be used.
+	checked := make(accountApis)
+	for i := range workItems {
+		workItems[i] = router.route(workItems[i])
+		if _, err := checked.get(workItems[i].account); err != nil {
+			return UploadPlan{}, err
+		}
+	}
+
+	planned := make([]UploadPlanItem, len(workItems))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(AppConfig.UploadThreads, 1), len(workItems)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			apis := make(accountApis)
+			for index := range indexes {
+				item := workItems[index]
+				api, _ := apis.get(item.account)
+				planned[index] = planUploadWorkItem(ctx, api, item)
+			}
+		}()
+	}
+	for index := range workItems {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return UploadPlan{}, err
+	}
+
+	plan.Items = append(planned, plan.Items...)
+	return plan, nil
+}
+
+// planUploadWorkItem predicts the outcome of item.
+func planUploadWorkItem(ctx context.Context, api remoteMediaFinder, item UploadWorkItem) UploadPlanItem {
+	planItem := UploadPlanItem{
+		Path:        uploadWorkPrimaryPath(item),
+		Paths:       uploadWorkPaths(item),
+		IsLivePhoto: item.Kind == UploadWorkLivePhoto,
+		Account:     item.account,
+	}
+	fail := func(err error) UploadPlanItem {
+		planItem.Action = PlanActionError
+		planItem.Reason = err.Error()
+		return planItem
+	}
+
+	if item.Kind == UploadWorkLivePhoto && item.LivePhoto != nil {
+		photoKey, err := planRemoteLookup(ctx, api, item.LivePhoto.PhotoPath)
+		if err != nil {
+			return fail(fmt.Errorf("check Live Photo still deduplication: %w", err))
+		}
+		videoKey, err := planRemoteLookup(ctx, api, item.LivePhoto.VideoPath)
+		if err != nil {
+			return fail(fmt.Errorf("check Live Photo video deduplication: %w", err))
+		}
+		switch {
+		case photoKey != "" && AppConfig.UpdateExistingPhotosToLive:
+			planItem.Action = PlanActionUpdateToLive
+			planItem.MediaKey = photoKey
+		case photoKey != "":
+			planItem.Action = PlanActionSkip
+			planItem.MediaKey = photoKey
+			planItem.Reason = "a Live Photo component already exists remotely"
+			return planItem
+		case videoKey != "":
+			planItem.Action = PlanActionSkip
+			planItem.MediaKey = videoKey
+			planItem.Reason = "the Live Photo video already exists remotely"
+			return planItem
+		default:
+			planItem.Action = PlanActionUploadLivePhoto
+		}
+	} else {
+		planItem.Action = PlanActionUpload
+		if AppConfig.ForceUpload {
+			// Mirror uploadFileWithCallback, which hashes but never checks.
+			if _, err := planRemoteLookup(ctx, nil, planItem.Path); err != nil {
+				return fail(err)
+			}
+		} else {
+			mediaKey, err := planRemoteLookup(ctx, api, planItem.Path)
+			if err != nil {
+				// A failed check is not fatal during a real upload either.
+				planItem.Reason = fmt.Sprintf("remote check failed, would upload anyway: %v", err)
+			}
+			if mediaKey != "" {
+				planItem.Action = PlanActionExists
+				planItem.MediaKey = mediaKey
+			}
+		}
+	}
+
+	planItem.Album = plannedAlbum(planItem.Path, item.album)
+	planItem.DeleteLocal = AppConfig.DeleteFromHost
+	return planItem
+}
+
+// planRemoteLookup hashes path through the local cache and, when
+// api is not nil, returns the media key of a remote duplicate. Hashes are
+// cached just like during a real upload, so the following run does not hash
+// again.
+func planRemoteLookup(ctx context.Context, api remoteMediaFinder, path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("error getting file info: %w", err)
+	}
+	hash, err := hashFileWithCache(ctx, path, info)
+	if err != nil {
+		return "", fmt.Errorf("error calculating hash file: %w", err)
+	}
+	if api == nil {
+		return "", nil
+	}
+	return api.FindRemoteMediaByHash(ctx, hash)
+}
+
+// plannedAlbum mirrors handleAlbumCreation and createAlbumsFromDirectories.
+func plannedAlbum(path string, album string) string {
+	albumName, albumAutoMode := GetAlbumConfig()
+	albumName, albumAutoMode = routeAlbum(album, albumName, albumAutoMode)
+	if !albumAutoMode {
+		return albumName
+	}
+	albumName = filepath.Base(filepath.Dir(path))
+	if albumName == "" || albumName == "." {
+		albumName = "Uploads"
+	}
+	return albumName
+}
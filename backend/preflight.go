@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Preflight codes for files that would be rejected or arrive broken. They are
+// reported as skipped items before any network traffic.
+const (
+	PreflightCodeEmptyFile     = "empty-file"
+	PreflightCodeFileTooLarge  = "file-too-large"
+	PreflightCodeTruncatedFile = "truncated-file"
+)
+
+// Google Photos size limits per item.
+const (
+	maxPhotoUploadSize = 200 << 20
+	maxVideoUploadSize = 10 << 30
+)
+
+// jpegTailScanSize is how much of a JPEG's end is checked for the EOI marker
+// before falling back to walking the whole entropy-coded data.
+const jpegTailScanSize = 64
+
+// validateUploadFile returns a warning when path, whose mediaFormat is format,
+// should not be uploaded. Files that cannot be read are left to fail during
+// upload with their error.
+func validateUploadFile(path string, format string) (PreflightWarning, bool) {
+	warn := func(code string, format string, args ...any) (PreflightWarning, bool) {
+		return PreflightWarning{Paths: []string{path}, Code: code, Message: fmt.Sprintf(format, args...)}, true
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return PreflightWarning{}, false
+	}
+	size := info.Size()
+	if size == 0 {
+		return warn(PreflightCodeEmptyFile, "file is empty")
+	}
+
+	switch supportedFormats[format] {
+	case MediaClassPhoto, MediaClassRaw:
+		if size > maxPhotoUploadSize {
+			return warn(PreflightCodeFileTooLarge, "photo is %d MB, over the %d MB limit", size>>20, maxPhotoUploadSize>>20)
+		}
+	case MediaClassVideo:
+		if size > maxVideoUploadSize {
+			return warn(PreflightCodeFileTooLarge, "video is %d GB, over the %d GB limit", size>>30, maxVideoUploadSize>>30)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return PreflightWarning{}, false
+	}
+	defer file.Close()
+
+	switch format {
+	case "jpg":
+		if !jpegHasEndMarker(file, size) {
+			return warn(PreflightCodeTruncatedFile, "JPEG has no end-of-image marker")
+		}
+	case "mp4", "mov", "m4v", "3gp", "3g2":
+		if err := checkMP4Structure(file, size, true); err != nil {
+			return warn(PreflightCodeTruncatedFile, "%v", err)
+		}
+	case "heic", "heif", "avif", "cr3":
+		if err := checkMP4Structure(file, size, false); err != nil {
+			return warn(PreflightCodeTruncatedFile, "%v", err)
+		}
+	}
+	return PreflightWarning{}, false
+}
+
+// checkMP4Structure walks the boxes and fails when one runs past the end of
+// the file, which is what an interrupted copy looks like.
+func checkMP4Structure(reader io.ReaderAt, size int64, requireMovie bool) error {
+	hasMovie := false
+	err := walkMP4Boxes(reader, 0, size, func(box mp4Box) error {
+		if string(box.typ[:]) == "moov" {
+			hasMovie = true
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("container is damaged or truncated: %w", err)
+	}
+	if requireMovie && !hasMovie {
+		return fmt.Errorf("video has no moov box")
+	}
+	return nil
+}
+
+// jpegHasEndMarker checks the tail for FFD9 first. Files with data after the
+// image, such as motion photos, are then walked marker by marker, skipping
+// segment payloads, stuffed bytes and restart markers.
+func jpegHasEndMarker(file *os.File, size int64) bool {
+	tail := make([]byte, min(size, jpegTailScanSize))
+	if _, err := file.ReadAt(tail, size-int64(len(tail))); err != nil {
+		return true
+	}
+	end := len(tail)
+	for end > 0 && (tail[end-1] == 0x00 || tail[end-1] == 0xFF) {
+		end-- // padding after EOI
+	}
+	if end >= 2 && tail[end-2] == 0xFF && tail[end-1] == 0xD9 {
+		return true
+	}
+
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, 0, size), 256<<10)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return false
+		}
+		if b != 0xFF {
+			continue
+		}
+		marker, err := reader.ReadByte()
+		for err == nil && marker == 0xFF {
+			marker, err = reader.ReadByte()
+		}
+		if err != nil {
+			return false
+		}
+		switch {
+		case marker == 0xD9:
+			return true
+		case marker == 0x00, marker >= 0xD0 && marker <= 0xD8, marker == 0x01:
+			// Stuffed byte, restart marker, SOI or TEM: no length follows.
+		default:
+			// Segment with a length. Skip it so its payload cannot fake an EOI.
+			var length [2]byte
+			if _, err := io.ReadFull(reader, length[:]); err != nil {
+				return false
+			}
+			skip := (int(length[0])<<8 | int(length[1])) - 2
+			if skip < 0 {
+				return false
+			}
+			if _, err := reader.Discard(skip); err != nil {
+				return false
+			}
+		}
+	}
+}
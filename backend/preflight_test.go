@@ -0,0 +1,59 @@
+package backend
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJPEGHasEndMarker(t *testing.T) {
+	const (
+		soi = "\xFF\xD8"
+		eoi = "\xFF\xD9"
+		// APP0 with a 16-byte length, so 14 bytes of payload follow.
+		app0 = "\xFF\xE0\x00\x10JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"
+		// APP1 whose payload contains FFD9, which must not count as the end.
+		app1FakeEOI = "\xFF\xE1\x00\x08\xFF\xD9\xFF\xD9\x00\x00"
+		sos         = "\xFF\xDA\x00\x0C\x03\x01\x00\x02\x11\x03\x11\x00\x3F\x00"
+		// Entropy-coded data with a stuffed byte and a restart marker.
+		scan = "\x12\x34\xFF\x00\x56\xFF\xD0\x78\x9A"
+	)
+	// trailer stands for the video of a motion photo, long enough to push the
+	// EOI out of the checked tail.
+	trailer := string(bytes.Repeat([]byte("\x00\x00\x00\x18ftypmp42"), 16))
+
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"complete", soi + app0 + sos + scan + eoi, true},
+		{"padded after end", soi + app0 + sos + scan + eoi + "\x00\x00\xFF\xFF", true},
+		{"truncated", soi + app0 + sos + scan, false},
+		{"cut inside a segment", soi + app0[:8], false},
+		{"motion photo", soi + app0 + sos + scan + eoi + trailer, true},
+		{"motion photo without end", soi + app0 + sos + scan + trailer, false},
+		{"end marker only in a segment payload", soi + app1FakeEOI + sos + scan + trailer, false},
+		{"end marker after a segment with one", soi + app1FakeEOI + sos + scan + eoi + trailer, true},
+		{"fill bytes before the end marker", soi + app0 + sos + scan + "\xFF\xFF\xD9" + trailer, true},
+		{"invalid segment length", soi + "\xFF\xE0\x00\x01" + trailer, false},
+		{"only start of image", soi, false},
+	}
+	dir := t.TempDir()
+	for i, test := range tests {
+		path := filepath.Join(dir, string(rune('a'+i))+".jpg")
+		if err := os.WriteFile(path, []byte(test.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := jpegHasEndMarker(file, int64(len(test.content)))
+		_ = file.Close()
+		if got != test.want {
+			t.Errorf("%s: jpegHasEndMarker = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
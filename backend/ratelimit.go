@@ -0,0 +1,249 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bandwidthChunkSize caps the bytes a single read may take from the bucket,
+// so that workers sharing a small limit take turns instead of one of them
+// sending a whole buffer at a time.
+const bandwidthChunkSize = 32 << 10
+
+// bandwidthRecheckInterval bounds how long a throttled read sleeps before it
+// looks at the schedule again, so a window that opens or ends mid-run takes
+// effect without restarting the upload.
+const bandwidthRecheckInterval = time.Second
+
+// RateSchedule is an upload bandwidth limit in bytes per second that may
+// depend on the time of day. Zero means unlimited.
+type RateSchedule struct {
+	// Default applies outside of every window.
+	Default int64
+	// Windows are checked in order and the first one containing the local
+	// time of day wins.
+	Windows []RateWindow
+}
+
+// RateWindow limits the bandwidth between Start and End, given as offsets
+// from local midnight. A window whose End is before its Start runs past
+// midnight.
+type RateWindow struct {
+	Start time.Duration
+	End   time.Duration
+	Rate  int64
+}
+
+// ParseRateSchedule parses a comma separated list of a default rate and
+// HH:MM-HH:MM=RATE windows, such as "2M", "08:00-19:00=2M" or
+// "08:00-19:00=2M,10M". Rates take the same suffixes as sizes and are per
+// second; 0, off and unlimited disable the limit. An empty spec is unlimited.
+func ParseRateSchedule(spec string) (RateSchedule, error) {
+	var schedule RateSchedule
+	defaultSet := false
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		window, rateText, isWindow := strings.Cut(entry, "=")
+		if !isWindow {
+			rateText = entry
+		}
+		rate, err := parseRate(rateText)
+		if err != nil {
+			return RateSchedule{}, err
+		}
+		if !isWindow {
+			if defaultSet {
+				return RateSchedule{}, fmt.Errorf("rate schedule %q has more than one default rate", spec)
+			}
+			schedule.Default = rate
+			defaultSet = true
+			continue
+		}
+		startText, endText, ok := strings.Cut(window, "-")
+		if !ok {
+			return RateSchedule{}, fmt.Errorf("invalid rate window %q, use HH:MM-HH:MM=RATE", entry)
+		}
+		start, err := parseTimeOfDay(startText)
+		if err != nil {
+			return RateSchedule{}, err
+		}
+		end, err := parseTimeOfDay(endText)
+		if err != nil {
+			return RateSchedule{}, err
+		}
+		if start == end {
+			return RateSchedule{}, fmt.Errorf("rate window %q is empty", entry)
+		}
+		schedule.Windows = append(schedule.Windows, RateWindow{Start: start, End: end, Rate: rate})
+	}
+	return schedule, nil
+}
+
+func parseRate(value string) (int64, error) {
+	text := strings.ToLower(strings.TrimSpace(value))
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "/s"), "ps")
+	if text == "off" || text == "unlimited" {
+		return 0, nil
+	}
+	rate, err := ParseByteSize(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q, use a size per second such as 500K or 2M", value)
+	}
+	return rate, nil
+}
+
+// parseTimeOfDay parses HH:MM, where 24:00 is the end of the day.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	text := strings.TrimSpace(value)
+	if text == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	parsed, err := time.Parse("15:04", text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, use HH:MM", value)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// rateAt returns the limit in effect at t.
+func (s RateSchedule) rateAt(t time.Time) int64 {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	for _, window := range s.Windows {
+		inside := offset >= window.Start && offset < window.End
+		if window.End < window.Start {
+			inside = offset >= window.Start || offset < window.End
+		}
+		if inside {
+			return window.Rate
+		}
+	}
+	return s.Default
+}
+
+func (s RateSchedule) unlimited() bool {
+	if s.Default > 0 {
+		return false
+	}
+	for _, window := range s.Windows {
+		if window.Rate > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bandwidthLimiter is a token bucket shared by every upload worker. The
+// bucket holds at most one second of the current rate.
+type bandwidthLimiter struct {
+	mu       sync.Mutex
+	schedule RateSchedule
+	rate     int64
+	tokens   float64
+	last     time.Time
+}
+
+// uploadBandwidth limits the request bodies of all uploads in this process.
+var uploadBandwidth = &bandwidthLimiter{}
+
+// configureUploadBandwidth applies AppConfig.LimitRate to the uploads that
+// follow. An invalid schedule is reported and leaves the uploads unlimited.
+func configureUploadBandwidth(app AppInterface) {
+	schedule, err := ParseRateSchedule(AppConfig.LimitRate)
+	if err != nil {
+		app.GetLogger().Warn(fmt.Sprintf("ignoring limit_rate: %v", err))
+	}
+	uploadBandwidth.setSchedule(schedule)
+}
+
+func (l *bandwidthLimiter) setSchedule(schedule RateSchedule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.schedule = schedule
+	l.rate = 0
+}
+
+// wait blocks until n bytes may be sent.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		rate := l.schedule.rateAt(now)
+		if rate <= 0 {
+			l.rate = 0
+			l.mu.Unlock()
+			return nil
+		}
+		if rate != l.rate {
+			// Start a new rate with an empty bucket so a raised limit does
+			// not begin with a burst.
+			l.rate, l.tokens, l.last = rate, 0, now
+		}
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(rate), float64(rate))
+		l.last = now
+		need := float64(min(int64(n), rate))
+		if l.tokens >= need {
+			l.tokens -= float64(n)
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((need - l.tokens) / float64(rate) * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(min(delay, bandwidthRecheckInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// refund returns tokens taken for bytes that were not read after all.
+func (l *bandwidthLimiter) refund(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate > 0 {
+		l.tokens = min(l.tokens+float64(n), float64(l.rate))
+	}
+}
+
+// reader returns r throttled by the limiter. With no limit configured r is
+// returned as is.
+func (l *bandwidthLimiter) reader(ctx context.Context, r io.Reader) io.Reader {
+	l.mu.Lock()
+	unlimited := l.schedule.unlimited()
+	l.mu.Unlock()
+	if unlimited {
+		return r
+	}
+	return &limitedReader{ctx: ctx, limiter: l, reader: r}
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	limiter *bandwidthLimiter
+	reader  io.Reader
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > bandwidthChunkSize {
+		p = p[:bandwidthChunkSize]
+	}
+	if err := r.limiter.wait(r.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	n, err := r.reader.Read(p)
+	if n < len(p) {
+		r.limiter.refund(len(p) - n)
+	}
+	return n, err
+}
@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRateSchedule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    RateSchedule
+		wantErr bool
+	}{
+		{spec: "", want: RateSchedule{}},
+		{spec: " , ", want: RateSchedule{}},
+		{spec: "2M", want: RateSchedule{Default: 2 << 20}},
+		{spec: "500K/s", want: RateSchedule{Default: 500 << 10}},
+		{spec: "1.5mbps", want: RateSchedule{Default: 3 << 19}},
+		{spec: "1024", want: RateSchedule{Default: 1024}},
+		{spec: "off", want: RateSchedule{}},
+		{spec: "Unlimited", want: RateSchedule{}},
+		{spec: "0", want: RateSchedule{}},
+		{
+			spec: "08:00-19:00=2M",
+			want: RateSchedule{Windows: []RateWindow{{Start: 8 * time.Hour, End: 19 * time.Hour, Rate: 2 << 20}}},
+		},
+		{
+			spec: "08:00-19:00=2M, 10M",
+			want: RateSchedule{
+				Default: 10 << 20,
+				Windows: []RateWindow{{Start: 8 * time.Hour, End: 19 * time.Hour, Rate: 2 << 20}},
+			},
+		},
+		{
+			spec: "22:30-06:15=off,18:00-24:00=1M,500K",
+			want: RateSchedule{
+				Default: 500 << 10,
+				Windows: []RateWindow{
+					{Start: 22*time.Hour + 30*time.Minute, End: 6*time.Hour + 15*time.Minute},
+					{Start: 18 * time.Hour, End: 24 * time.Hour, Rate: 1 << 20},
+				},
+			},
+		},
+		{spec: "2M,3M", wantErr: true},
+		{spec: "fast", wantErr: true},
+		{spec: "-1M", wantErr: true},
+		{spec: "08:00=2M", wantErr: true},
+		{spec: "08:00-08:00=2M", wantErr: true},
+		{spec: "25:00-26:00=2M", wantErr: true},
+		{spec: "8-19=2M", wantErr: true},
+		{spec: "08:00-19:00=fast", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParseRateSchedule(test.spec)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseRateSchedule(%q) = %+v, want an error", test.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRateSchedule(%q) error: %v", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseRateSchedule(%q) = %+v, want %+v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestRateScheduleRateAt(t *testing.T) {
+	schedule, err := ParseRateSchedule("08:00-19:00=2M,22:00-06:00=off,10M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		clock string
+		want  int64
+	}{
+		{"07:59", 10 << 20},
+		{"08:00", 2 << 20},
+		{"18:59", 2 << 20},
+		{"19:00", 10 << 20},
+		{"21:59", 10 << 20},
+		{"22:00", 0},
+		{"00:00", 0},
+		{"05:59", 0},
+		{"06:00", 10 << 20},
+	}
+	for _, test := range tests {
+		clock, err := time.ParseInLocation("15:04", test.clock, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		at := time.Date(2026, time.March, 2, clock.Hour(), clock.Minute(), 0, 0, time.Local)
+		if got := schedule.rateAt(at); got != test.want {
+			t.Errorf("rateAt(%s) = %d, want %d", test.clock, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package backend
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// AccountRoute sends the files under Path to Account, so that one run can
+// upload the backups of several devices to their own accounts.
+type AccountRoute struct {
+	// Path is a directory prefix, or a glob such as /nas/phones/*/DCIM that
+	// is matched against a file and each of its parent directories. Relative
+	// paths start from the directory of the config file.
+	Path string `json:"path" koanf:"path"`
+	// Account is the exact email of a stored credential.
+	Account string `json:"account" koanf:"account"`
+	// Album is used for the routed files when the run has no album of its
+	// own. "AUTO" creates albums from folder names.
+	Album string `json:"album" koanf:"album"`
+}
+
+// uploadTarget is where one work item goes.
+type uploadTarget struct {
+	account string
+	album   string
+}
+
+type compiledRoute struct {
+	pattern string
+	glob    bool
+	target  uploadTarget
+}
+
+// accountRouter picks the account of each file from AppConfig.Routes. The
+// first matching route wins and files without one go to the fallback.
+type accountRouter struct {
+	routes   []compiledRoute
+	fallback string
+}
+
+// newAccountRouter resolves the accounts of routes up front, so that a typo
+// fails the run before anything is uploaded. An account given for the run
+// replaces the routes.
+func newAccountRouter(routes []AccountRoute, account string) (*accountRouter, error) {
+	if account != "" {
+		return &accountRouter{fallback: account}, nil
+	}
+	router := &accountRouter{fallback: AppConfig.Selected}
+	for i, route := range routes {
+		if route.Path == "" || route.Account == "" {
+			return nil, fmt.Errorf("route %d needs both a path and an account", i+1)
+		}
+		// Unlike --account, routes run unattended, so a partial email that
+		// matches a credential added later must not break them.
+		if _, err := AccountCredential(route.Account); err != nil {
+			return nil, fmt.Errorf("route for %s: %w", route.Path, err)
+		}
+		pattern := route.Path
+		if !filepath.IsAbs(pattern) {
+			if ConfigPath == "" {
+				determineConfigPath()
+			}
+			pattern = filepath.Join(filepath.Dir(ConfigPath), pattern)
+		}
+		glob := strings.ContainsAny(route.Path, "*?[")
+		pattern = canonicalRoutePattern(pattern, glob)
+		if glob {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("route for %s: %w", route.Path, err)
+			}
+		}
+		router.routes = append(router.routes, compiledRoute{
+			pattern: routePathKey(pattern),
+			glob:    glob,
+			target:  uploadTarget{account: route.Account, album: route.Album},
+		})
+	}
+	return router, nil
+}
+
+// target returns the account and route album for path.
+func (r *accountRouter) target(path string) uploadTarget {
+	if len(r.routes) == 0 {
+		return uploadTarget{account: r.fallback}
+	}
+	path = routePathKey(canonicalUploadPath(path))
+	for _, route := range r.routes {
+		if route.matches(path) {
+			return route.target
+		}
+	}
+	return uploadTarget{account: r.fallback}
+}
+
+// route sets the account and route album of item from its primary path. Both
+// halves of a Live Photo pair go to the account of the photo.
+func (r *accountRouter) route(item UploadWorkItem) UploadWorkItem {
+	target := r.target(uploadWorkPrimaryPath(item))
+	item.account, item.album = target.account, target.album
+	return item
+}
+
+// canonicalRoutePattern resolves symlinks in pattern like canonicalUploadPath
+// does for the files, so that a route matches whichever mount path reaches
+// them. Only the part of a glob before its first wildcard is resolved.
+func canonicalRoutePattern(pattern string, glob bool) string {
+	if !glob {
+		return canonicalUploadPath(pattern)
+	}
+	pattern = filepath.Clean(pattern)
+	prefix, rest := pattern, ""
+	for strings.ContainsAny(prefix, "*?[") {
+		rest = filepath.Join(filepath.Base(prefix), rest)
+		prefix = filepath.Dir(prefix)
+	}
+	return filepath.Join(canonicalUploadPath(prefix), rest)
+}
+
+func (c compiledRoute) matches(path string) bool {
+	if !c.glob {
+		return path == c.pattern || strings.HasPrefix(path, strings.TrimSuffix(c.pattern, string(filepath.Separator))+string(filepath.Separator))
+	}
+	for {
+		if matched, _ := filepath.Match(c.pattern, path); matched {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// routePathKey folds case on Windows, where paths are case-insensitive.
+func routePathKey(path string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// routeAlbum returns the album settings of files routed with album, or the
+// run's own settings when it has an album.
+func routeAlbum(album string, albumName string, albumAutoMode bool) (string, bool) {
+	if albumName != "" || albumAutoMode {
+		return albumName, albumAutoMode
+	}
+	if strings.EqualFold(album, "AUTO") {
+		return "", true
+	}
+	return album, false
+}
+
+// accountApis keeps one client per account for a single goroutine, since an
+// Api is not safe for concurrent use. Clients of the same account still share
+// one bearer token.
+type accountApis map[string]accountApi
+
+type accountApi struct {
+	api *Api
+	err error
+}
+
+func (a accountApis) get(account string) (*Api, error) {
+	entry, ok := a[account]
+	if !ok {
+		entry.api, entry.err = newAccountApi(account)
+		a[account] = entry
+	}
+	return entry.api, entry.err
+}
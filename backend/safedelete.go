@@ -0,0 +1,377 @@
+package backend
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trashManifestName is the append-only restore manifest kept in the trash
+// directory. Each line is one TrashEntry.
+const trashManifestName = "manifest.jsonl"
+
+// Remote verification retries briefly because a freshly committed item can
+// take a moment to become visible to the hash lookup.
+var verifyDeleteDelays = []time.Duration{2 * time.Second, 5 * time.Second}
+
+// TrashEntry records where a trashed file came from so it can be restored.
+type TrashEntry struct {
+	OriginalPath string    `json:"originalPath"`
+	TrashPath    string    `json:"trashPath"`
+	MediaKey     string    `json:"mediaKey,omitempty"`
+	SHA1         string    `json:"sha1,omitempty"`
+	TrashedAt    time.Time `json:"trashedAt"`
+}
+
+// localDeletePolicy controls how local files are removed after upload.
+type localDeletePolicy struct {
+	// Verify re-queries every component by hash before anything is removed.
+	Verify bool
+	// TrashDir moves files there instead of deleting them when not empty.
+	TrashDir string
+}
+
+func currentLocalDeletePolicy() localDeletePolicy {
+	return localDeletePolicy{Verify: AppConfig.VerifyBeforeDelete, TrashDir: AppConfig.TrashDir}
+}
+
+// localFile is one local component of an uploaded media item.
+type localFile struct {
+	Path string
+	SHA1 []byte
+}
+
+var trashMu sync.Mutex
+
+// removeUploadedFiles deletes or trashes the local components of mediaKey.
+// With verification enabled no file is touched unless every component is
+// visible remotely as mediaKey. The components are removed all or nothing,
+// so a Live Photo never loses only one of them.
+func removeUploadedFiles(ctx context.Context, api remoteMediaFinder, policy localDeletePolicy, mediaKey string, files ...localFile) error {
+	if policy.Verify {
+		for _, file := range files {
+			if err := verifyRemoteMedia(ctx, api, file, mediaKey); err != nil {
+				return err
+			}
+		}
+	}
+	if policy.TrashDir != "" {
+		return trashUploadedFiles(policy.TrashDir, mediaKey, files)
+	}
+	return deleteUploadedFiles(files)
+}
+
+// verifyRemoteMedia checks that the content of file is in the library as
+// mediaKey. It bypasses the hash cache on purpose: the point is to ask the
+// library again, not to trust what this run already believes.
+func verifyRemoteMedia(ctx context.Context, api remoteMediaFinder, file localFile, mediaKey string) error {
+	var (
+		lastErr  error
+		foundKey string
+	)
+	for attempt := 0; ; attempt++ {
+		found, err := api.FindRemoteMediaByHash(ctx, file.SHA1)
+		if err == nil && found == mediaKey {
+			return nil
+		}
+		lastErr, foundKey = err, found
+		if attempt >= len(verifyDeleteDelays) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("verify %s before delete: %w", filepath.Base(file.Path), ctx.Err())
+		case <-time.After(verifyDeleteDelays[attempt]):
+		}
+	}
+	switch {
+	case lastErr != nil:
+		return fmt.Errorf("verify %s before delete: %w", filepath.Base(file.Path), lastErr)
+	case foundKey != "":
+		return fmt.Errorf("verify %s before delete: found as %s instead of %s, keeping local file", filepath.Base(file.Path), foundKey, mediaKey)
+	default:
+		return fmt.Errorf("verify %s before delete: not found in library, keeping local file", filepath.Base(file.Path))
+	}
+}
+
+// deleteSuffix marks a file that is about to be deleted. It changes the
+// extension so that a scan running meanwhile does not pick the file up.
+const deleteSuffix = ".gotohp-delete"
+
+// deleteUploadedFiles renames every file before deleting any, and renames
+// them back if one cannot be renamed.
+func deleteUploadedFiles(files []localFile) error {
+	if len(files) == 1 {
+		return os.Remove(files[0].Path)
+	}
+	staged := make([]string, 0, len(files))
+	for _, file := range files {
+		if err := os.Rename(file.Path, file.Path+deleteSuffix); err != nil {
+			for i, path := range staged {
+				_ = os.Rename(path, files[i].Path)
+			}
+			return err
+		}
+		staged = append(staged, file.Path+deleteSuffix)
+	}
+	for _, path := range staged {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trashUploadedFiles moves files to trashDir and restores the ones already
+// moved if one cannot be.
+func trashUploadedFiles(trashDir string, mediaKey string, files []localFile) error {
+	trashed := make(map[string]bool, len(files))
+	for _, file := range files {
+		entry, err := moveToTrash(trashDir, file, mediaKey)
+		if err != nil {
+			if len(trashed) > 0 {
+				results, restoreErr := RestoreFromTrash(trashDir, func(entry TrashEntry) bool {
+					return trashed[entry.TrashPath]
+				})
+				for _, result := range results {
+					if result.Error != "" && restoreErr == nil {
+						restoreErr = errors.New(result.Error)
+					}
+				}
+				if restoreErr != nil {
+					return fmt.Errorf("%w (restoring the other components failed: %v)", err, restoreErr)
+				}
+			}
+			return err
+		}
+		trashed[entry.TrashPath] = true
+	}
+	return nil
+}
+
+// moveToTrash moves file into a dated folder under trashDir and appends a
+// manifest entry for it.
+func moveToTrash(trashDir string, file localFile, mediaKey string) (TrashEntry, error) {
+	originalPath, err := filepath.Abs(file.Path)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	// Absolute paths keep the manifest usable from any working directory.
+	trashDir, err = filepath.Abs(trashDir)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	now := time.Now()
+	dayDir := filepath.Join(trashDir, now.Format(time.DateOnly))
+
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	if err := os.MkdirAll(dayDir, 0o755); err != nil {
+		return TrashEntry{}, fmt.Errorf("create trash directory: %w", err)
+	}
+	trashPath := uniqueTrashPath(dayDir, filepath.Base(originalPath))
+	if err := moveFile(originalPath, trashPath); err != nil {
+		return TrashEntry{}, fmt.Errorf("move to trash: %w", err)
+	}
+	entry := TrashEntry{
+		OriginalPath: originalPath,
+		TrashPath:    trashPath,
+		MediaKey:     mediaKey,
+		SHA1:         hex.EncodeToString(file.SHA1),
+		TrashedAt:    now,
+	}
+	if err := appendTrashManifest(trashDir, entry); err != nil {
+		// Without a manifest entry the file could not be restored by the tool.
+		if restoreErr := moveFile(trashPath, originalPath); restoreErr != nil {
+			return TrashEntry{}, fmt.Errorf("write trash manifest: %w (file left at %s)", err, trashPath)
+		}
+		return TrashEntry{}, fmt.Errorf("write trash manifest: %w", err)
+	}
+	return entry, nil
+}
+
+func uniqueTrashPath(dir string, name string) string {
+	candidate := filepath.Join(dir, name)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(candidate); errors.Is(err, os.ErrNotExist) {
+			return candidate
+		}
+		candidate = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, n, ext))
+	}
+}
+
+// moveFile renames src to dst and falls back to copy and delete when they are
+// on different volumes.
+func moveFile(src string, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	info, statErr := os.Stat(src)
+	if statErr != nil {
+		return err
+	}
+	if copyErr := copyFile(src, dst, info); copyErr != nil {
+		_ = os.Remove(dst)
+		return copyErr
+	}
+	return os.Remove(src)
+}
+
+func copyFile(src string, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+func appendTrashManifest(trashDir string, entry TrashEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	manifest, err := os.OpenFile(filepath.Join(trashDir, trashManifestName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := manifest.Write(append(data, '\n')); err != nil {
+		manifest.Close()
+		return err
+	}
+	return manifest.Close()
+}
+
+// ListTrash returns the manifest entries of trashDir, oldest first.
+func ListTrash(trashDir string) ([]TrashEntry, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	return readTrashManifest(trashDir)
+}
+
+func readTrashManifest(trashDir string) ([]TrashEntry, error) {
+	manifest, err := os.Open(filepath.Join(trashDir, trashManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer manifest.Close()
+
+	var entries []TrashEntry
+	scanner := bufio.NewScanner(manifest)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry TrashEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", trashManifestName, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func writeTrashManifest(trashDir string, entries []TrashEntry) error {
+	path := filepath.Join(trashDir, trashManifestName)
+	tmp, err := os.CreateTemp(trashDir, trashManifestName+".*")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(tmp)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// TrashRestoreResult is the outcome of restoring one TrashEntry.
+type TrashRestoreResult struct {
+	TrashEntry
+	Error string `json:"error,omitempty"`
+}
+
+// RestoreFromTrash moves every entry selected by match back to its original
+// path. Entries whose original path is occupied again are left in the trash.
+// Restored entries are removed from the manifest.
+func RestoreFromTrash(trashDir string, match func(TrashEntry) bool) ([]TrashRestoreResult, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	entries, err := readTrashManifest(trashDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []TrashRestoreResult
+	remaining := make([]TrashEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !match(entry) {
+			remaining = append(remaining, entry)
+			continue
+		}
+		result := TrashRestoreResult{TrashEntry: entry}
+		if err := restoreTrashEntry(entry); err != nil {
+			result.Error = err.Error()
+			remaining = append(remaining, entry)
+		}
+		results = append(results, result)
+	}
+	if len(remaining) != len(entries) {
+		if err := writeTrashManifest(trashDir, remaining); err != nil {
+			return results, fmt.Errorf("update %s: %w", trashManifestName, err)
+		}
+	}
+	return results, nil
+}
+
+func restoreTrashEntry(entry TrashEntry) error {
+	if _, err := os.Lstat(entry.OriginalPath); err == nil {
+		return fmt.Errorf("%s already exists", entry.OriginalPath)
+	}
+	if _, err := os.Stat(entry.TrashPath); err != nil {
+		return fmt.Errorf("trashed copy is missing: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(entry.OriginalPath), 0o755); err != nil {
+		return err
+	}
+	return moveFile(entry.TrashPath, entry.OriginalPath)
+}
@@ -0,0 +1,274 @@
+package backend
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// ignoreFileName is read from every scanned directory. It uses gitignore
+// syntax and applies to that directory and everything below it.
+const ignoreFileName = ".gotohpignore"
+
+// scanPattern is one compiled gitignore-style pattern.
+type scanPattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// scanRuleSet is a list of patterns relative to base. Later patterns win.
+type scanRuleSet struct {
+	base     string
+	patterns []scanPattern
+}
+
+// scanFilter decides which entries a directory scan keeps. Exclude rules are
+// evaluated outermost first, so a .gotohpignore deeper in the tree overrides
+// its parents and the configured patterns, as in git.
+type scanFilter struct {
+	root     string
+	rules    []scanRuleSet
+	includes []scanPattern
+}
+
+// ValidateScanPatterns reports the first pattern that cannot be compiled.
+func ValidateScanPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, _, err := compileScanPattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newScanFilter builds the filter for one scan root from the configured
+// patterns. legacyExcludeDir is the old single directory name setting.
+func newScanFilter(root string, excludes []string, includes []string, legacyExcludeDir string) (*scanFilter, error) {
+	filter := &scanFilter{root: root}
+	configured := scanRuleSet{base: root}
+	if legacyExcludeDir != "" {
+		configured.patterns = append(configured.patterns, scanPattern{
+			re:      regexp.MustCompile(caseFlag() + `^(?:.*/)?` + regexp.QuoteMeta(legacyExcludeDir) + `$`),
+			dirOnly: true,
+		})
+	}
+	for _, exclude := range excludes {
+		pattern, ok, err := compileScanPattern(exclude)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			configured.patterns = append(configured.patterns, pattern)
+		}
+	}
+	if len(configured.patterns) > 0 {
+		filter.rules = append(filter.rules, configured)
+	}
+	for _, include := range includes {
+		pattern, ok, err := compileScanPattern(include)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filter.includes = append(filter.includes, pattern)
+		}
+	}
+	return filter, nil
+}
+
+// enter returns the filter for dir, extended with its .gotohpignore if any.
+// Unreadable ignore files and invalid lines are skipped like git does.
+func (f *scanFilter) enter(dir string) *scanFilter {
+	file, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if err != nil {
+		return f
+	}
+	defer file.Close()
+
+	rules := scanRuleSet{base: dir}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if pattern, ok, err := compileScanPattern(scanner.Text()); err == nil && ok {
+			rules.patterns = append(rules.patterns, pattern)
+		}
+	}
+	if len(rules.patterns) == 0 {
+		return f
+	}
+	next := *f
+	next.rules = append(slices.Clip(f.rules), rules)
+	return &next
+}
+
+func (f *scanFilter) excluded(path string, isDir bool) bool {
+	excluded := false
+	for _, rules := range f.rules {
+		rel, ok := relativeSlashPath(rules.base, path)
+		if !ok {
+			continue
+		}
+		for _, pattern := range rules.patterns {
+			if pattern.dirOnly && !isDir {
+				continue
+			}
+			if pattern.re.MatchString(rel) {
+				excluded = !pattern.negate
+			}
+		}
+	}
+	return excluded
+}
+
+// included reports whether a file matches the include patterns. Without
+// include patterns every file is included.
+func (f *scanFilter) included(path string) bool {
+	if len(f.includes) == 0 {
+		return true
+	}
+	rel, ok := relativeSlashPath(f.root, path)
+	if !ok {
+		return false
+	}
+	included := false
+	for _, pattern := range f.includes {
+		if pattern.re.MatchString(rel) {
+			included = !pattern.negate
+		}
+	}
+	return included
+}
+
+func relativeSlashPath(base string, path string) (string, bool) {
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// compileScanPattern compiles one gitignore line. ok is false for blank lines
+// and comments.
+func compileScanPattern(line string) (pattern scanPattern, ok bool, err error) {
+	text := trimUnescapedTrailingSpaces(strings.TrimRight(line, "\r"))
+	if text == "" || strings.HasPrefix(text, "#") {
+		return scanPattern{}, false, nil
+	}
+	switch {
+	case strings.HasPrefix(text, "!"):
+		pattern.negate = true
+		text = text[1:]
+	case strings.HasPrefix(text, `\!`), strings.HasPrefix(text, `\#`):
+		text = text[1:]
+	}
+	if strings.HasSuffix(text, "/") {
+		pattern.dirOnly = true
+		text = strings.TrimRight(text, "/")
+	}
+	// A slash anywhere but at the end anchors the pattern to its base.
+	anchored := strings.Contains(text, "/")
+	text = strings.TrimPrefix(text, "/")
+	if text == "" {
+		return scanPattern{}, false, nil
+	}
+
+	expression := globToRegexp(text)
+	if anchored {
+		expression = "^" + expression + "$"
+	} else {
+		expression = "^(?:.*/)?" + expression + "$"
+	}
+	pattern.re, err = regexp.Compile(caseFlag() + expression)
+	if err != nil {
+		return scanPattern{}, false, fmt.Errorf("invalid pattern %q: %w", line, err)
+	}
+	return pattern, true, nil
+}
+
+// globToRegexp translates gitignore wildcards: "*" and "?" stay within one
+// path segment, "**/" matches any number of leading directories and a
+// trailing "/**" matches everything inside.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				segmentStart := i == 0 || glob[i-1] == '/'
+				next := i + 2
+				switch {
+				case segmentStart && next < len(glob) && glob[next] == '/':
+					b.WriteString("(?:.*/)?")
+					i = next
+				case segmentStart && next == len(glob):
+					b.WriteString(".*")
+					i = next - 1
+				default:
+					b.WriteString("[^/]*")
+					i = next - 1
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := closingBracket(glob, i)
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `[`, `\[`) + "]")
+			i = end
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String()
+}
+
+func closingBracket(glob string, open int) int {
+	i := open + 1
+	if i < len(glob) && (glob[i] == '!' || glob[i] == '^') {
+		i++
+	}
+	if i < len(glob) && glob[i] == ']' {
+		i++
+	}
+	for ; i < len(glob); i++ {
+		if glob[i] == ']' {
+			return i
+		}
+	}
+	return -1
+}
+
+func trimUnescapedTrailingSpaces(text string) string {
+	for strings.HasSuffix(text, " ") && !strings.HasSuffix(text, `\ `) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// caseFlag makes patterns case-insensitive where the file system usually is.
+func caseFlag() string {
+	if runtime.GOOS == "windows" {
+		return "(?i)"
+	}
+	return ""
+}
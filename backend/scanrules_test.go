@@ -0,0 +1,157 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompileScanPattern(t *testing.T) {
+	tests := []struct {
+		line     string
+		negate   bool
+		dirOnly  bool
+		match    []string
+		noMatch  []string
+		disabled bool
+	}{
+		{line: "", disabled: true},
+		{line: "   ", disabled: true},
+		{line: "# comment", disabled: true},
+		{line: "/", disabled: true},
+		{line: "*.tmp", match: []string{"a.tmp", "dir/a.tmp", "a/b/.tmp"}, noMatch: []string{"a.tmpx", "a.tmp/b"}},
+		{line: "?.jpg", match: []string{"a.jpg", "dir/b.jpg"}, noMatch: []string{"ab.jpg", ".jpg"}},
+		{line: "@eaDir", match: []string{"@eaDir", "a/b/@eaDir"}, noMatch: []string{"@eaDir2", "x@eaDir"}},
+		{line: "/build", match: []string{"build"}, noMatch: []string{"src/build", "build2"}},
+		{line: "doc/*.txt", match: []string{"doc/a.txt"}, noMatch: []string{"x/doc/a.txt", "doc/sub/a.txt"}},
+		{line: "**/logs", match: []string{"logs", "a/logs", "a/b/logs"}, noMatch: []string{"logs2", "a/logs/b"}},
+		{line: "logs/**", match: []string{"logs/a", "logs/a/b"}, noMatch: []string{"logs", "a/logs/b"}},
+		{line: "a/**/b", match: []string{"a/b", "a/x/b", "a/x/y/b"}, noMatch: []string{"a/xb", "x/a/b"}},
+		{line: "**.jpg", match: []string{"a.jpg", "x/a.jpg"}, noMatch: []string{"a.png"}},
+		{line: "Thumbs/", dirOnly: true, match: []string{"Thumbs", "a/Thumbs"}, noMatch: []string{"Thumbs/a"}},
+		{line: "cache//", dirOnly: true, match: []string{"cache", "a/cache"}},
+		{line: "!keep.jpg", negate: true, match: []string{"keep.jpg", "a/keep.jpg"}, noMatch: []string{"keep.png"}},
+		{line: `\!important.jpg`, match: []string{"!important.jpg"}, noMatch: []string{"important.jpg"}},
+		{line: `\#notcomment`, match: []string{"#notcomment"}},
+		{line: "file[0-9].jpg", match: []string{"file1.jpg"}, noMatch: []string{"filea.jpg", "file10.jpg"}},
+		{line: "file[!0-9].jpg", match: []string{"filea.jpg"}, noMatch: []string{"file1.jpg"}},
+		{line: "file[]].jpg", match: []string{"file].jpg"}, noMatch: []string{"filea.jpg"}},
+		{line: "file[.jpg", match: []string{"file[.jpg"}, noMatch: []string{"filea.jpg"}},
+		{line: `a\*b`, match: []string{"a*b"}, noMatch: []string{"axb"}},
+		{line: "trailing   ", match: []string{"trailing"}, noMatch: []string{"trailing "}},
+		{line: `space\ `, match: []string{"space "}, noMatch: []string{"space"}},
+		{line: "crlf.jpg\r", match: []string{"crlf.jpg"}},
+	}
+	for _, test := range tests {
+		pattern, ok, err := compileScanPattern(test.line)
+		if err != nil {
+			t.Errorf("compileScanPattern(%q) error: %v", test.line, err)
+			continue
+		}
+		if ok == test.disabled {
+			t.Errorf("compileScanPattern(%q) ok = %v, want %v", test.line, ok, !test.disabled)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if pattern.negate != test.negate || pattern.dirOnly != test.dirOnly {
+			t.Errorf("compileScanPattern(%q) negate, dirOnly = %v, %v, want %v, %v",
+				test.line, pattern.negate, pattern.dirOnly, test.negate, test.dirOnly)
+		}
+		for _, path := range test.match {
+			if !pattern.re.MatchString(path) {
+				t.Errorf("pattern %q does not match %q", test.line, path)
+			}
+		}
+		for _, path := range test.noMatch {
+			if pattern.re.MatchString(path) {
+				t.Errorf("pattern %q matches %q", test.line, path)
+			}
+		}
+	}
+}
+
+func TestValidateScanPatterns(t *testing.T) {
+	if err := ValidateScanPatterns([]string{"*.tmp", "!keep.tmp", "dir/", "file[0-9]"}); err != nil {
+		t.Errorf("ValidateScanPatterns error: %v", err)
+	}
+	if err := ValidateScanPatterns([]string{"file[z-a]"}); err == nil {
+		t.Error("ValidateScanPatterns accepted a reversed character range")
+	}
+}
+
+func TestScanFilterExcluded(t *testing.T) {
+	root := t.TempDir()
+	filter, err := newScanFilter(root, []string{"*.tmp", "!keep.tmp", "cache/"}, nil, "@eaDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, ignoreFileName), []byte("# deeper rules win\n!*.tmp\nraw/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	subFilter := filter.enter(sub)
+
+	tests := []struct {
+		filter *scanFilter
+		path   string
+		isDir  bool
+		want   bool
+	}{
+		{filter, "a.tmp", false, true},
+		{filter, "keep.tmp", false, false},
+		{filter, "a.jpg", false, false},
+		{filter, "cache", true, true},
+		{filter, "cache", false, false},
+		{filter, "x/cache", true, true},
+		{filter, "@eaDir", true, true},
+		{filter, "x/@eaDir", true, true},
+		{filter, "@eaDir", false, false},
+		{filter, "sub/raw", true, false},
+		{subFilter, "sub/a.tmp", false, false},
+		{subFilter, "sub/raw", true, true},
+		{subFilter, "raw", true, false},
+		{subFilter, "sub/cache", true, true},
+	}
+	for _, test := range tests {
+		path := filepath.Join(root, filepath.FromSlash(test.path))
+		if got := test.filter.excluded(path, test.isDir); got != test.want {
+			t.Errorf("excluded(%q, dir=%v) = %v, want %v", test.path, test.isDir, got, test.want)
+		}
+	}
+}
+
+func TestScanFilterIncluded(t *testing.T) {
+	root := t.TempDir()
+	filter, err := newScanFilter(root, nil, []string{"*.jpg", "!private/**"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"a.jpg", true},
+		{"dir/a.jpg", true},
+		{"a.png", false},
+		{"private/a.jpg", false},
+	}
+	for _, test := range tests {
+		if got := filter.included(filepath.Join(root, filepath.FromSlash(test.path))); got != test.want {
+			t.Errorf("included(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+
+	unfiltered, err := newScanFilter(root, nil, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !unfiltered.included(filepath.Join(root, "a.png")) {
+		t.Error("a filter without include patterns excluded a file")
+	}
+}
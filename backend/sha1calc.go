@@ -4,8 +4,10 @@ import (
 	"context"
 	"crypto/sha1"
 	"fmt"
+	"hash"
 	"io"
 	"os"
+	"sync"
 )
 
 const (
@@ -54,3 +56,70 @@ func CalculateSHA1(ctx context.Context, filePath string) ([]byte, error) {
 
 	return hash.Sum(nil), nil
 }
+
+// streamHasher computes the SHA-1 of a file from the bytes of its upload. A
+// retry resends from the offset the server committed, which is never past
+// what was already read, so bytes it has seen are skipped instead of being
+// hashed twice.
+type streamHasher struct {
+	mu     sync.Mutex
+	hash   hash.Hash
+	hashed int64
+}
+
+func newStreamHasher() *streamHasher {
+	return &streamHasher{hash: sha1.New()}
+}
+
+// reader returns r, positioned at offset in the file, with every byte read
+// from it passed to the hasher.
+func (s *streamHasher) reader(r io.Reader, offset int64) io.Reader {
+	return &streamHashReader{hasher: s, reader: r, offset: offset}
+}
+
+func (s *streamHasher) observe(offset int64, p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	end := offset + int64(len(p))
+	if offset > s.hashed || end <= s.hashed {
+		return
+	}
+	s.hash.Write(p[s.hashed-offset:])
+	s.hashed = end
+}
+
+// sum returns the hash of the whole file. Whatever the upload did not read,
+// such as a tail the server already had from an earlier attempt, is read
+// from the file.
+func (s *streamHasher) sum(ctx context.Context, filePath string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	if _, err := file.Seek(s.hashed, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error calculating hash: %w", err)
+	}
+	cw := &chunkedContextWriter{ctx: ctx, w: s.hash}
+	if _, err := io.CopyBuffer(cw, file, make([]byte, copyBufferSize)); err != nil {
+		return nil, fmt.Errorf("error calculating hash: %w", err)
+	}
+	return s.hash.Sum(nil), nil
+}
+
+type streamHashReader struct {
+	hasher *streamHasher
+	reader io.Reader
+	offset int64
+}
+
+func (r *streamHashReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.hasher.observe(r.offset, p[:n])
+		r.offset += int64(n)
+	}
+	return n, err
+}
@@ -0,0 +1,104 @@
+package backend
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// stateDBFileName is the SQLite database kept next to the config file. It holds
+// local upload state that must survive restarts but does not belong in the
+// user-editable YAML config.
+const stateDBFileName = "gotohp.db"
+
+// stateDBSchema is applied in order on every open. Statements must be
+// idempotent so older databases are upgraded in place.
+var stateDBSchema = []string{
+	`CREATE TABLE IF NOT EXISTS upload_sessions (
+		path       TEXT NOT NULL,
+		account    TEXT NOT NULL DEFAULT '',
+		size       INTEGER NOT NULL,
+		mtime_ns   INTEGER NOT NULL,
+		sha1       BLOB NOT NULL,
+		upload_id  TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (path, account)
+	)`,
+	`CREATE TABLE IF NOT EXISTS hash_cache (
+		path       TEXT PRIMARY KEY,
+		size       INTEGER NOT NULL,
+		mtime_ns   INTEGER NOT NULL,
+		inode      INTEGER NOT NULL,
+		sha1       BLOB NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS upload_history (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		run_id        TEXT NOT NULL,
+		path          TEXT NOT NULL,
+		paths         TEXT NOT NULL DEFAULT '',
+		sha1          TEXT NOT NULL DEFAULT '',
+		media_key     TEXT NOT NULL DEFAULT '',
+		album_keys    TEXT NOT NULL DEFAULT '',
+		account       TEXT NOT NULL DEFAULT '',
+		uploaded_at   INTEGER NOT NULL,
+		is_live_photo INTEGER NOT NULL DEFAULT 0,
+		is_error      INTEGER NOT NULL DEFAULT 0,
+		error         TEXT NOT NULL DEFAULT '',
+		skipped       INTEGER NOT NULL DEFAULT 0,
+		skip_code     TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS upload_history_path ON upload_history (path)`,
+	`CREATE INDEX IF NOT EXISTS upload_history_run ON upload_history (run_id, media_key)`,
+	`CREATE TABLE IF NOT EXISTS upload_runs (
+		run_id     TEXT PRIMARY KEY,
+		started_at INTEGER NOT NULL,
+		account    TEXT NOT NULL DEFAULT '',
+		options    TEXT NOT NULL DEFAULT ''
+	)`,
+}
+
+var (
+	stateDBOnce sync.Once
+	stateDB     *sql.DB
+	stateDBErr  error
+)
+
+func stateDBPath() string {
+	if ConfigPath == "" {
+		determineConfigPath()
+	}
+	return filepath.Join(filepath.Dir(ConfigPath), stateDBFileName)
+}
+
+// openStateDB lazily opens the shared state database. Callers treat a failure
+// as "no persistent state" so uploads keep working on read-only config dirs.
+func openStateDB() (*sql.DB, error) {
+	stateDBOnce.Do(func() {
+		path := stateDBPath()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			stateDBErr = fmt.Errorf("create state directory: %w", err)
+			return
+		}
+		// Overlapping cron runs share this file, so wait for locks instead of
+		// failing immediately, and use WAL so readers do not block the writer.
+		dsn := "file:" + filepath.ToSlash(path) + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			stateDBErr = fmt.Errorf("open state database: %w", err)
+			return
+		}
+		db.SetMaxOpenConns(1)
+		for _, statement := range stateDBSchema {
+			if _, err := db.Exec(statement); err != nil {
+				_ = db.Close()
+				stateDBErr = fmt.Errorf("migrate state database: %w", err)
+				return
+			}
+		}
+		stateDB = db
+	})
+	return stateDB, stateDBErr
+}
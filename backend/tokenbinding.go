@@ -181,12 +181,30 @@ func buildTokenBindingAssertionJWT(signingKey *ecdsa.PrivateKey, issuer string,
 	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
 }
 
+// tokenBindingError tags failures to prepare a token binding assertion or to
+// decrypt a bound token.
+type tokenBindingError struct {
+	err error
+}
+
+func (e tokenBindingError) Error() string {
+	return e.err.Error()
+}
+
+func (e tokenBindingError) Unwrap() error {
+	return e.err
+}
+
+// errTokenBindingMissing means the server bound the token to a device key the
+// credential does not name.
+var errTokenBindingMissing = errors.New("auth response returned TokenEncrypted=1 but credential has no token_binding_alias")
+
 func decryptTokenEncryptedResponse(parsed map[string]string, session *tokenBindingSession) error {
 	if parsed["TokenEncrypted"] != "1" {
 		return nil
 	}
 	if session == nil {
-		return errors.New("auth response returned TokenEncrypted=1 but credential has no token_binding_alias")
+		return errTokenBindingMissing
 	}
 
 	encryptedToken := parsed["Auth"]
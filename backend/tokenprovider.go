@@ -0,0 +1,223 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bearerTokenRefreshMargin is how long before its expiry a token is replaced,
+// so that a request started just before does not run into a rejected token.
+const bearerTokenRefreshMargin = 5 * time.Minute
+
+// tokenCacheFileName is kept next to the config file when
+// AppConfig.TokenCache is set. It holds bearer tokens, so it is written with
+// owner-only permissions.
+const tokenCacheFileName = "token_cache.json"
+
+type cachedBearerToken struct {
+	Token  string `json:"token"`
+	Expiry int64  `json:"expiry"`
+}
+
+func (t cachedBearerToken) fresh(now time.Time) bool {
+	return t.Token != "" && now.Add(bearerTokenRefreshMargin).Unix() < t.Expiry
+}
+
+// tokenProvider hands out bearer tokens to every Api of the process, so that
+// the workers of an upload share one auth exchange per credential instead of
+// each doing their own.
+type tokenProvider struct {
+	mu      sync.Mutex
+	entries map[string]*tokenProviderEntry
+}
+
+type tokenProviderEntry struct {
+	mu    sync.Mutex
+	token cachedBearerToken
+}
+
+var bearerTokens = &tokenProvider{entries: make(map[string]*tokenProviderEntry)}
+
+// tokenCacheKey identifies a credential without storing it.
+func tokenCacheKey(authData string) string {
+	sum := sha256.Sum256([]byte(authData))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *tokenProvider) entry(key string) *tokenProviderEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry := p.entries[key]
+	if entry == nil {
+		entry = &tokenProviderEntry{}
+		p.entries[key] = entry
+	}
+	return entry
+}
+
+// token returns a token for authData that stays valid for at least
+// bearerTokenRefreshMargin. Concurrent callers for the same credential wait
+// for a single call to fetch.
+func (p *tokenProvider) token(authData string, fetch func() (map[string]string, error)) (string, error) {
+	key := tokenCacheKey(authData)
+	entry := p.entry(key)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	now := time.Now()
+	if entry.token.fresh(now) {
+		return entry.token.Token, nil
+	}
+	if AppConfig.TokenCache {
+		if cached, ok := loadCachedBearerToken(key); ok && cached.fresh(now) {
+			entry.token = cached
+			return cached.Token, nil
+		}
+	}
+
+	resp, err := fetch()
+	if err != nil {
+		return "", fmt.Errorf("failed to get auth token: %w", err)
+	}
+	token, err := bearerTokenFromAuthResponse(resp)
+	if err != nil {
+		return "", err
+	}
+	p.storeLocked(key, entry, token)
+	return token.Token, nil
+}
+
+// put replaces the token of authData with one fetched elsewhere.
+func (p *tokenProvider) put(authData string, token cachedBearerToken) {
+	key := tokenCacheKey(authData)
+	entry := p.entry(key)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	p.storeLocked(key, entry, token)
+}
+
+// invalidate forgets token, which the server rejected, in memory and in the
+// token cache, so that the next caller exchanges the credential again. A
+// token that another caller has already replaced is left alone.
+func (p *tokenProvider) invalidate(authData string, token string) {
+	key := tokenCacheKey(authData)
+	entry := p.entry(key)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.token.Token == token {
+		entry.token = cachedBearerToken{}
+	}
+	if AppConfig.TokenCache {
+		_ = deleteCachedBearerToken(key, token)
+	}
+}
+
+func (p *tokenProvider) storeLocked(key string, entry *tokenProviderEntry, token cachedBearerToken) {
+	entry.token = token
+	if AppConfig.TokenCache {
+		// A cache that cannot be written only costs the next run an exchange.
+		_ = storeCachedBearerToken(key, token)
+	}
+}
+
+func bearerTokenFromAuthResponse(resp map[string]string) (cachedBearerToken, error) {
+	expiry, err := strconv.ParseInt(resp["Expiry"], 10, 64)
+	if err != nil {
+		return cachedBearerToken{}, fmt.Errorf("invalid expiry time: %w", err)
+	}
+	return cachedBearerToken{Token: resp["Auth"], Expiry: expiry}, nil
+}
+
+var tokenCacheMu sync.Mutex
+
+func tokenCachePath() string {
+	if ConfigPath == "" {
+		determineConfigPath()
+	}
+	return filepath.Join(filepath.Dir(ConfigPath), tokenCacheFileName)
+}
+
+func readTokenCache() map[string]cachedBearerToken {
+	tokens := make(map[string]cachedBearerToken)
+	data, err := os.ReadFile(tokenCachePath())
+	if err != nil {
+		return tokens
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return make(map[string]cachedBearerToken)
+	}
+	return tokens
+}
+
+func loadCachedBearerToken(key string) (cachedBearerToken, bool) {
+	tokenCacheMu.Lock()
+	defer tokenCacheMu.Unlock()
+	token, ok := readTokenCache()[key]
+	return token, ok
+}
+
+// storeCachedBearerToken adds token to the cache file and drops expired
+// entries.
+func storeCachedBearerToken(key string, token cachedBearerToken) error {
+	tokenCacheMu.Lock()
+	defer tokenCacheMu.Unlock()
+
+	tokens := readTokenCache()
+	tokens[key] = token
+	return writeTokenCache(tokens)
+}
+
+// deleteCachedBearerToken removes the entry of key from the cache file if it
+// still holds token.
+func deleteCachedBearerToken(key string, token string) error {
+	tokenCacheMu.Lock()
+	defer tokenCacheMu.Unlock()
+
+	tokens := readTokenCache()
+	if cached, ok := tokens[key]; !ok || cached.Token != token {
+		return nil
+	}
+	delete(tokens, key)
+	return writeTokenCache(tokens)
+}
+
+// writeTokenCache replaces the cache file atomically with tokens, minus the
+// expired ones; os.CreateTemp creates it 0600. The caller holds tokenCacheMu.
+func writeTokenCache(tokens map[string]cachedBearerToken) error {
+	now := time.Now().Unix()
+	for k, cached := range tokens {
+		if cached.Expiry <= now {
+			delete(tokens, k)
+		}
+	}
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	path := tokenCachePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), tokenCacheFileName+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
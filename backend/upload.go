@@ -2,14 +2,13 @@ package backend
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
-	"strings"
+	"slices"
 	"sync"
+	"sync/atomic"
 )
 
 // FilesDroppedEvent is emitted when files are dropped on any drop zone
@@ -32,6 +31,7 @@ type UploadManager struct {
 	cancel   chan struct{}
 	canceled bool
 	running  bool
+	done     chan struct{}
 	app      AppInterface
 }
 
@@ -73,6 +73,17 @@ func (m *UploadManager) isCancelled() bool {
 	}
 }
 
+// Wait blocks until the batch started by the last Upload call has emitted
+// uploadStop, including album creation.
+func (m *UploadManager) Wait() {
+	m.mu.Lock()
+	done := m.done
+	m.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
 // getCancelChan returns the cancel channel safely
 func (m *UploadManager) getCancelChan() <-chan struct{} {
 	m.mu.Lock()
@@ -85,6 +96,14 @@ type UploadBatchStart struct {
 	TotalBytes int64 `json:"TotalBytes"`
 }
 
+// UploadBatchTotal updates the totals of UploadBatchStart while the scan is
+// still finding files. Scanning is false on the last update.
+type UploadBatchTotal struct {
+	Total      int   `json:"Total"`
+	TotalBytes int64 `json:"TotalBytes"`
+	Scanning   bool  `json:"Scanning"`
+}
+
 type FileUploadResult struct {
 	MediaKey     string   `json:"MediaKey"`
 	IsError      bool     `json:"IsError"`
@@ -96,6 +115,12 @@ type FileUploadResult struct {
 	ErrorMessage string   `json:"ErrorMessage"`
 	Path         string   `json:"Path"`
 	Paths        []string `json:"Paths"`
+	// Account is the email of the account the item was routed to.
+	Account string `json:"Account,omitempty"`
+	// album is the album of the item's route, used to group its upload.
+	album string
+	// sha1 is the content hash of the primary file, when it was hashed.
+	sha1 []byte
 }
 
 type ThreadStatus struct {
@@ -109,7 +134,28 @@ type ThreadStatus struct {
 	Attempt       int    `json:"Attempt"` // Current attempt number (1-based), 0 if not applicable
 }
 
+// UploadRunSettings are the album and account of one run.
+type UploadRunSettings struct {
+	AlbumName     string
+	AlbumAutoMode bool
+	// Account replaces the routes and the selected account when not empty.
+	Account string
+}
+
+// CurrentUploadRunSettings returns the run settings of AppConfig.
+func CurrentUploadRunSettings() UploadRunSettings {
+	albumName, albumAutoMode := GetAlbumConfig()
+	return UploadRunSettings{AlbumName: albumName, AlbumAutoMode: albumAutoMode, Account: AppConfig.Account}
+}
+
+// Upload uploads paths with the album and account of AppConfig.
 func (m *UploadManager) Upload(app AppInterface, paths []string) {
+	m.UploadWithSettings(app, paths, CurrentUploadRunSettings())
+}
+
+// UploadWithSettings uploads paths with the album and account of settings,
+// leaving AppConfig untouched.
+func (m *UploadManager) UploadWithSettings(app AppInterface, paths []string, settings UploadRunSettings) {
 	m.mu.Lock()
 	if m.running {
 		m.mu.Unlock()
@@ -118,107 +164,78 @@ func (m *UploadManager) Upload(app AppInterface, paths []string) {
 	m.running = true
 	m.cancel = make(chan struct{})
 	m.canceled = false
+	m.done = make(chan struct{})
 	m.mu.Unlock()
 
-	// Make preflight visible immediately so a long directory or metadata scan can
-	// be cancelled from the UI.
+	// Make the batch visible immediately so a long directory or metadata scan
+	// can be cancelled from the UI. Totals follow as the scan finds files.
 	app.EmitEvent("uploadStart", UploadBatchStart{})
 
-	targetPaths, err := filterGooglePhotosFilesWithCancel(paths, m.isCancelled)
+	// Accounts are fixed for the whole run, even if another account is
+	// selected meanwhile.
+	router, err := newAccountRouter(AppConfig.Routes, settings.Account)
 	if err != nil {
-		if errors.Is(err, context.Canceled) {
-			m.finishPreflight(app)
-			return
-		}
-		app.EmitEvent("FileStatus", FileUploadResult{
-			IsError:      true,
-			Error:        err,
-			ErrorMessage: err.Error(),
-		})
-		m.finishPreflight(app)
-		return
-	}
-	workItems, preflightWarnings := ClassifyUploadWork(targetPaths, LivePhotoClassificationOptions{
-		Enabled:             AppConfig.PairLivePhotos,
-		SkipIncomplete:      AppConfig.SkipIncompleteLivePhotos,
-		IgnoreAppleMetadata: AppConfig.IgnoreAppleMetadata,
-		Cancelled:           m.isCancelled,
-	}, nil)
-	if m.isCancelled() {
-		m.finishPreflight(app)
-		return
-	}
-	emitUploadPreflight(app, len(workItems), preflightWarnings)
-
-	if len(workItems) == 0 {
-		m.finishPreflight(app)
+		app.GetLogger().Error(fmt.Sprintf("invalid account routes: %v", err))
+		app.EmitEvent("FileStatus", FileUploadResult{IsError: true, Error: err, ErrorMessage: err.Error()})
+		m.finishUpload(app)
 		return
 	}
-
-	if _, err := NewApi(); err != nil {
-		for _, item := range workItems {
-			path := uploadWorkPrimaryPath(item)
-			app.EmitEvent("FileStatus", FileUploadResult{
-				IsError:      true,
-				Error:        err,
-				ErrorMessage: err.Error(),
-				Path:         path,
-			})
-		}
-		app.EmitEvent("uploadStop", nil)
-		m.mu.Lock()
-		m.running = false
-		m.mu.Unlock()
-		return
-	}
-
-	// Calculate total bytes asynchronously and emit update when complete
-	go func() {
-		var totalBytes int64
-		for _, item := range workItems {
-			for _, path := range uploadWorkPaths(item) {
-				if info, err := os.Stat(path); err == nil {
-					totalBytes += info.Size()
-				}
-			}
-		}
-		app.EmitEvent("uploadTotalBytes", totalBytes)
-	}()
+	runOptions := CurrentUploadRunOptions()
+	runOptions.AlbumName, runOptions.AlbumAutoMode = settings.AlbumName, settings.AlbumAutoMode
+	history := newHistoryRecorder(router.fallback, runOptions)
 
 	if AppConfig.UploadThreads < 1 {
 		AppConfig.UploadThreads = 1
 	}
-
-	// Don't start more threads than files to process
-	numWorkers := min(AppConfig.UploadThreads, len(workItems))
-
-	// Create a worker pool for concurrent uploads
-	workChan := make(chan UploadWorkItem, len(workItems))
-	results := make(chan FileUploadResult, len(workItems))
-
-	// Start workers
-	for i := range numWorkers {
-		m.wg.Add(1)
-		go startUploadWorker(i, workChan, results, m.cancel, &m.wg, app)
+	if AppConfig.HashThreads < 1 {
+		AppConfig.HashThreads = 1
 	}
+	configureUploadBandwidth(app)
+	uploadCongestion.reset(AppConfig.UploadThreads, AppConfig.AdaptiveThreads, app.GetLogger())
+	hashWhileUploadUnsupported.Clear()
 
-	// Send work to workers
+	// Closed by the results loop once AppConfig.MaxFailures is reached. The
+	// scan stops with it, and work that was found but not started is dropped.
+	// notAttempted records whether either left anything out.
+	stopDispatch := make(chan struct{})
+	var notAttempted atomic.Bool
+
+	// Scanning, classification and the workers are connected by bounded
+	// queues, so uploads start with the first directory and memory use does
+	// not grow with the size of the tree.
+	batches := make(chan uploadScanBatch, uploadScanQueueSize)
+	scanErr := make(chan error, 1)
 	go func() {
-	LOOP:
-		for _, item := range workItems {
+		defer close(batches)
+		scanner := newUploadScanner(m.isCancelled, true, uploadScanChunkSizeFor(AppConfig.PairLivePhotos))
+		scanErr <- scanner.scan(paths, func(batch uploadScanBatch) error {
 			select {
 			case <-m.cancel:
-				break LOOP
-			case workChan <- item:
+				return context.Canceled
+			case <-stopDispatch:
+				notAttempted.Store(true)
+				return context.Canceled
+			case batches <- batch:
+				return nil
 			}
-		}
-		close(workChan)
+		})
 	}()
 
+	workChan := make(chan UploadWorkItem, AppConfig.UploadThreads)
+	results := make(chan FileUploadResult, AppConfig.UploadThreads)
+
+	// Written by the dispatcher, and read by the results loop once the
+	// dispatcher and the workers are done.
+	var progress UploadBatchTotal
+
+	m.wg.Add(1)
+	go m.dispatchUploads(app, router, batches, scanErr, workChan, results, stopDispatch, &notAttempted, &progress)
+
 	// Handle results, wait for completion, and create album if configured
 	go func() {
-		// Collect successful uploads with path -> mediaKey mapping for AUTO mode
-		successfulUploads := make(map[string]string) // path -> mediaKey
+		// Collect successful uploads with path -> mediaKey mapping for AUTO
+		// mode, by account and route album.
+		successfulUploads := make(map[uploadTarget]map[string]string)
 
 		// Wait for all workers to finish in a separate goroutine, then close results
 		go func() {
@@ -227,84 +244,207 @@ func (m *UploadManager) Upload(app AppInterface, paths []string) {
 		}()
 
 		// Process all results (this blocks until results channel is closed)
+		failures := 0
 		for result := range results {
 			app.EmitEvent("FileStatus", result)
+			history.record(result)
 			if result.IsError {
 				s := fmt.Sprintf("upload error: %v", result.Error)
 				app.GetLogger().Error(s)
+				failures++
+				if AppConfig.MaxFailures > 0 && failures == AppConfig.MaxFailures {
+					app.GetLogger().Warn(fmt.Sprintf("%d uploads failed, not starting the remaining files", failures))
+					close(stopDispatch)
+				}
 			} else {
 				s := fmt.Sprintf("upload success: %v", result.Path)
 				app.GetLogger().Info(s)
 				if result.MediaKey != "" {
-					successfulUploads[result.Path] = result.MediaKey
+					target := uploadTarget{account: result.Account, album: result.album}
+					if successfulUploads[target] == nil {
+						successfulUploads[target] = make(map[string]string)
+					}
+					successfulUploads[target][result.Path] = result.MediaKey
 				}
 			}
 		}
+		if notAttempted.Load() {
+			// One result stands for everything left out, so that a retry
+			// scans the arguments again instead of listing every file.
+			progress.Total++
+			app.EmitEvent("uploadTotal", progress)
+			result := FileUploadResult{
+				Skipped:    true,
+				SkipCode:   SkipCodeMaxFailures,
+				SkipReason: "The remaining files were not attempted because the failure limit was reached",
+				Path:       paths[0],
+				Paths:      paths,
+			}
+			app.EmitEvent("FileStatus", result)
+			history.record(result)
+		}
 
 		// Handle album creation after all results are processed
-		// Get album config atomically to avoid race conditions
-		albumName, albumAutoMode := GetAlbumConfig()
-		app.GetLogger().Info(fmt.Sprintf("Upload complete. Successful uploads: %d, AlbumName: '%s', AlbumAutoMode: %v",
-			len(successfulUploads), albumName, albumAutoMode))
-
-		if len(successfulUploads) > 0 {
-			m.handleAlbumCreation(app, successfulUploads, albumName, albumAutoMode)
+		for target, uploads := range successfulUploads {
+			targetAlbum, targetAutoMode := routeAlbum(target.album, settings.AlbumName, settings.AlbumAutoMode)
+			app.GetLogger().Info(fmt.Sprintf("Upload complete. Successful uploads to %s: %d, AlbumName: '%s', AlbumAutoMode: %v",
+				target.account, len(uploads), targetAlbum, targetAutoMode))
+			m.handleAlbumCreation(app, target.account, history, uploads, targetAlbum, targetAutoMode)
 		}
 
-		app.EmitEvent("uploadStop", nil)
-		m.mu.Lock()
-		m.running = false
-		m.mu.Unlock()
+		m.finishUpload(app)
 	}()
 }
 
-func (m *UploadManager) finishPreflight(app AppInterface) {
+func (m *UploadManager) finishUpload(app AppInterface) {
 	app.EmitEvent("uploadStop", nil)
 	m.mu.Lock()
 	m.running = false
+	if m.done != nil {
+		close(m.done)
+	}
 	m.mu.Unlock()
 }
 
-func emitUploadPreflight(app AppInterface, uploadItemCount int, warnings []PreflightWarning) {
-	skippedCount := 0
-	for _, warning := range warnings {
-		if isSkippedPreflightWarning(warning.Code) {
-			skippedCount++
+// dispatchUploads classifies each scanned batch, reports its skipped files and
+// hands its work items to the hashing stage, which passes them on to the
+// network workers. Both stages are started as work arrives so that a small
+// batch does not spin up idle threads. It closes workChan once the scan is
+// done, the upload is cancelled or stop is closed.
+func (m *UploadManager) dispatchUploads(app AppInterface, router *accountRouter, batches <-chan uploadScanBatch, scanErr <-chan error, workChan chan UploadWorkItem, results chan<- FileUploadResult, stop <-chan struct{}, notAttempted *atomic.Bool, progress *UploadBatchTotal) {
+	defer m.wg.Done()
+
+	// The bounded queues between the stages let hashing run a few items ahead
+	// of the network workers without reading the whole tree in advance.
+	hashChan := make(chan UploadWorkItem, AppConfig.HashThreads)
+	var hashWG sync.WaitGroup
+	defer func() {
+		close(hashChan)
+		hashWG.Wait()
+		close(workChan)
+	}()
+
+	options := currentLivePhotoClassification(m.isCancelled)
+	progress.Scanning = true
+	hashers := 0
+	workers := 0
+	for batch := range batches {
+		if m.isCancelled() {
+			continue // drain until the scanner stops
+		}
+		select {
+		case <-stop:
+			notAttempted.Store(true)
+			continue
+		default:
+		}
+		workItems, warnings := classifyUploadWork(batch.paths, batch.formats, options, nil)
+		warnings = slices.Concat(batch.warnings, warnings)
+
+		// Raise the total before reporting anything so that progress never
+		// runs ahead of it.
+		for _, warning := range warnings {
+			if IsSkippedPreflightWarning(warning.Code) {
+				progress.Total++
+			}
+		}
+		progress.Total += len(workItems)
+		for _, item := range workItems {
+			progress.TotalBytes += uploadWorkSize(item)
+		}
+		app.EmitEvent("uploadTotal", *progress)
+
+		for _, warning := range warnings {
+			app.EmitEvent("uploadWarning", warning)
+			if IsSkippedPreflightWarning(warning.Code) {
+				result := preflightSkipResult(warning)
+				result.Account = router.target(result.Path).account
+				results <- result
+			}
+		}
+
+	ITEMS:
+		for _, item := range workItems {
+			if hashers < AppConfig.HashThreads {
+				hashWG.Add(1)
+				go startHashWorker(hashChan, workChan, m.cancel, stop, &hashWG)
+				hashers++
+			}
+			if workers < AppConfig.UploadThreads {
+				m.wg.Add(1)
+				go startUploadWorker(workers, workChan, results, m.cancel, stop, notAttempted, &m.wg, app)
+				workers++
+			}
+			select {
+			case <-m.cancel:
+				break ITEMS
+			case <-stop:
+				notAttempted.Store(true)
+				break ITEMS
+			case hashChan <- router.route(item):
+			}
 		}
 	}
 
-	// Start before emitting warnings/results so the frontend resets its previous
-	// batch while retaining every event from this preflight.
-	app.EmitEvent("uploadStart", UploadBatchStart{
-		Total:      uploadItemCount + skippedCount,
-		TotalBytes: 0,
-	})
-	for _, warning := range warnings {
-		app.EmitEvent("uploadWarning", warning)
-		if !isSkippedPreflightWarning(warning.Code) {
-			continue
+	if err := <-scanErr; err != nil && !errors.Is(err, context.Canceled) {
+		results <- FileUploadResult{
+			IsError:      true,
+			Error:        err,
+			ErrorMessage: err.Error(),
 		}
-		primaryPath := ""
-		if len(warning.Paths) > 0 {
-			primaryPath = warning.Paths[0]
+	}
+	progress.Scanning = false
+	app.EmitEvent("uploadTotal", *progress)
+	app.EmitEvent("uploadTotalBytes", progress.TotalBytes)
+}
+
+// preflightSkipResult turns a skip warning into the result of its item.
+func preflightSkipResult(warning PreflightWarning) FileUploadResult {
+	primaryPath := ""
+	if len(warning.Paths) > 0 {
+		primaryPath = warning.Paths[0]
+	}
+	return FileUploadResult{
+		IsLivePhoto: isLivePhotoSkipCode(warning.Code),
+		Skipped:     true,
+		SkipCode:    warning.Code,
+		SkipReason:  warning.Message,
+		Path:        primaryPath,
+		Paths:       warning.Paths,
+	}
+}
+
+func uploadWorkSize(item UploadWorkItem) int64 {
+	var size int64
+	for _, path := range uploadWorkPaths(item) {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
 		}
-		app.EmitEvent("FileStatus", FileUploadResult{
-			IsLivePhoto: true,
-			Skipped:     true,
-			SkipCode:    warning.Code,
-			SkipReason:  warning.Message,
-			Path:        primaryPath,
-			Paths:       warning.Paths,
-		})
 	}
+	return size
+}
+
+// SkipCodeMaxFailures marks the single result that stands for everything not
+// attempted because AppConfig.MaxFailures was reached. Its Paths are the
+// arguments of the run.
+const SkipCodeMaxFailures = "max-failures-reached"
+
+// IsSkippedPreflightWarning reports whether a preflight warning stands for a
+// skipped item rather than a note about an item that is still uploaded.
+func IsSkippedPreflightWarning(code string) bool {
+	switch code {
+	case PreflightCodeEmptyFile, PreflightCodeFileTooLarge, PreflightCodeTruncatedFile:
+		return true
+	}
+	return isLivePhotoSkipCode(code) || isUploadFilterSkipCode(code)
 }
 
-func isSkippedPreflightWarning(code string) bool {
+func isLivePhotoSkipCode(code string) bool {
 	return code == "incomplete-live-photo-skipped" || code == "ambiguous-filename-stem"
 }
 
 // handleAlbumCreation handles album creation based on config (manual name/key or AUTO mode)
-func (m *UploadManager) handleAlbumCreation(app AppInterface, uploads map[string]string, albumName string, albumAutoMode bool) {
+func (m *UploadManager) handleAlbumCreation(app AppInterface, account string, history *historyRecorder, uploads map[string]string, albumName string, albumAutoMode bool) {
 	// Check if cancelled before starting album creation
 	if m.isCancelled() {
 		app.GetLogger().Info("Upload cancelled, skipping album creation")
@@ -314,7 +454,7 @@ func (m *UploadManager) handleAlbumCreation(app AppInterface, uploads map[string
 	app.GetLogger().Info(fmt.Sprintf("handleAlbumCreation called with %d uploads", len(uploads)))
 
 	// Create API once for all album operations
-	api, err := NewApi()
+	api, err := newAccountApi(account)
 	if err != nil {
 		app.GetLogger().Error(fmt.Sprintf("failed to create API for album creation: %v", err))
 		app.EmitEvent("albumError", AlbumError{
@@ -329,7 +469,7 @@ func (m *UploadManager) handleAlbumCreation(app AppInterface, uploads map[string
 	// Check if AUTO mode is enabled
 	if albumAutoMode {
 		app.GetLogger().Info("AUTO mode enabled, creating albums from directories")
-		m.createAlbumsFromDirectories(albumManager, app, uploads)
+		m.createAlbumsFromDirectories(albumManager, app, history, uploads)
 		return
 	}
 
@@ -357,11 +497,12 @@ func (m *UploadManager) handleAlbumCreation(app AppInterface, uploads map[string
 		})
 		return
 	}
+	history.attachAlbumKeys(mediaKeys, albumKeys)
 	app.GetLogger().Info(fmt.Sprintf("created album '%s' with %d items, album keys: %v", albumName, len(mediaKeys), albumKeys))
 }
 
 // createAlbumsFromDirectories creates albums based on parent directory names (AUTO mode)
-func (m *UploadManager) createAlbumsFromDirectories(albumManager *AlbumManager, app AppInterface, uploads map[string]string) {
+func (m *UploadManager) createAlbumsFromDirectories(albumManager *AlbumManager, app AppInterface, history *historyRecorder, uploads map[string]string) {
 	// Group media keys by parent directory
 	mediaKeysByDir := make(map[string][]string)
 
@@ -386,70 +527,24 @@ func (m *UploadManager) createAlbumsFromDirectories(albumManager *AlbumManager,
 			})
 			continue
 		}
+		history.attachAlbumKeys(mediaKeys, albumKeys)
 		app.GetLogger().Info(fmt.Sprintf("created album '%s' with %d items, album keys: %v", albumName, len(mediaKeys), albumKeys))
 	}
 }
 
-// supportedFormats is a map of file extensions supported by Google Photos (O(1) lookup)
-var supportedFormats = map[string]bool{
+// supportedFormats maps the file extensions supported by Google Photos to
+// their media class (O(1) lookup)
+var supportedFormats = map[string]string{
 	// Photo formats
-	"avif": true, "bmp": true, "gif": true, "heic": true, "heif": true, "ico": true,
-	"jpg": true, "jpeg": true, "png": true, "tif": true, "tiff": true, "webp": true,
-	"cr2": true, "cr3": true, "nef": true, "arw": true, "orf": true,
-	"raf": true, "rw2": true, "pef": true, "sr2": true, "dng": true,
+	"avif": MediaClassPhoto, "bmp": MediaClassPhoto, "gif": MediaClassPhoto, "heic": MediaClassPhoto, "heif": MediaClassPhoto, "ico": MediaClassPhoto,
+	"jpg": MediaClassPhoto, "jpeg": MediaClassPhoto, "png": MediaClassPhoto, "tif": MediaClassPhoto, "tiff": MediaClassPhoto, "webp": MediaClassPhoto,
+	"cr2": MediaClassRaw, "cr3": MediaClassRaw, "nef": MediaClassRaw, "arw": MediaClassRaw, "orf": MediaClassRaw,
+	"raf": MediaClassRaw, "rw2": MediaClassRaw, "pef": MediaClassRaw, "sr2": MediaClassRaw, "dng": MediaClassRaw,
 	// Video formats
-	"3gp": true, "3g2": true, "asf": true, "avi": true, "divx": true,
-	"m2t": true, "m2ts": true, "m4v": true, "mkv": true, "mmv": true,
-	"mod": true, "mov": true, "mp4": true, "mpg": true, "mpeg": true,
-	"mts": true, "tod": true, "wmv": true, "ts": true, "webm": true,
-}
-
-// isSupportedByGooglePhotos checks if a file extension is supported by Google Photos
-func isSupportedByGooglePhotos(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	if ext == "" {
-		return false
-	}
-	// Remove the dot and check map
-	return supportedFormats[ext[1:]]
-}
-
-func scanDirectoryForFiles(path string, recursive bool, excludePattern string, cancelled func() bool) ([]string, error) {
-	var files []string
-
-	if cancelled != nil && cancelled() {
-		return nil, context.Canceled
-	}
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, entry := range entries {
-		if cancelled != nil && cancelled() {
-			return nil, context.Canceled
-		}
-		fullPath := filepath.Join(path, entry.Name())
-		if entry.IsDir() {
-			if excludePattern != "" && entry.Name() == excludePattern {
-				continue
-			}
-			if recursive {
-				subFiles, err := scanDirectoryForFiles(fullPath, recursive, excludePattern, cancelled)
-				if err != nil {
-					if errors.Is(err, context.Canceled) {
-						return nil, err
-					}
-					continue
-				}
-				files = append(files, subFiles...)
-			}
-		} else {
-			files = append(files, fullPath)
-		}
-	}
-
-	return files, nil
+	"3gp": MediaClassVideo, "3g2": MediaClassVideo, "asf": MediaClassVideo, "avi": MediaClassVideo, "divx": MediaClassVideo,
+	"m2t": MediaClassVideo, "m2ts": MediaClassVideo, "m4v": MediaClassVideo, "mkv": MediaClassVideo, "mmv": MediaClassVideo,
+	"mod": MediaClassVideo, "mov": MediaClassVideo, "mp4": MediaClassVideo, "mpg": MediaClassVideo, "mpeg": MediaClassVideo,
+	"mts": MediaClassVideo, "tod": MediaClassVideo, "wmv": MediaClassVideo, "ts": MediaClassVideo, "webm": MediaClassVideo,
 }
 
 // FilterGooglePhotosFiles returns a list of files that are supported by Google Photos (exported)
@@ -459,68 +554,24 @@ func FilterGooglePhotosFiles(paths []string) ([]string, error) {
 
 // filterGooglePhotosFiles returns a list of files that are supported by Google Photos
 func filterGooglePhotosFiles(paths []string) ([]string, error) {
-	return filterGooglePhotosFilesWithCancel(paths, nil)
+	files, _, err := filterGooglePhotosFilesWithCancel(paths, nil)
+	return files, err
 }
 
-func filterGooglePhotosFilesWithCancel(paths []string, cancelled func() bool) ([]string, error) {
+// filterGooglePhotosFilesWithCancel also returns a skip warning for every file
+// removed by AppConfig.Filters, so those are reported instead of dropped.
+func filterGooglePhotosFilesWithCancel(paths []string, cancelled func() bool) ([]string, []PreflightWarning, error) {
 	var supportedFiles []string
-	type seenUploadFile struct {
-		canonicalPath string
-		info          os.FileInfo
-	}
-	seenFiles := make(map[string][]seenUploadFile)
-	appendFile := func(path string, info os.FileInfo) {
-		if !AppConfig.DisableUnsupportedFilesFilter && !isSupportedByGooglePhotos(path) {
-			return
-		}
-		canonicalPath := canonicalUploadPath(path)
-		bucketKey := canonicalPath
-		if runtime.GOOS == "windows" {
-			bucketKey = strings.ToLower(bucketKey)
-		}
-		if info == nil {
-			info, _ = os.Stat(path)
-		}
-		for _, seen := range seenFiles[bucketKey] {
-			if canonicalPath == seen.canonicalPath ||
-				(info != nil && seen.info != nil && os.SameFile(info, seen.info)) {
-				return
-			}
-		}
-		seenFiles[bucketKey] = append(seenFiles[bucketKey], seenUploadFile{
-			canonicalPath: canonicalPath,
-			info:          info,
-		})
-		supportedFiles = append(supportedFiles, path)
-	}
-
-	for _, path := range paths {
-		if cancelled != nil && cancelled() {
-			return nil, context.Canceled
-		}
-		fileInfo, err := os.Stat(path)
-		if err != nil {
-			return nil, fmt.Errorf("error accessing path %s: %w", path, err)
-		}
-
-		if fileInfo.IsDir() {
-			files, err := scanDirectoryForFiles(path, AppConfig.Recursive, AppConfig.ExcludePattern, cancelled)
-			if err != nil {
-				return nil, fmt.Errorf("error scanning directory %s: %w", path, err)
-			}
-
-			for _, file := range files {
-				if cancelled != nil && cancelled() {
-					return nil, context.Canceled
-				}
-				appendFile(file, nil)
-			}
-		} else {
-			appendFile(path, fileInfo)
-		}
+	var filtered []PreflightWarning
+	err := newUploadScanner(cancelled, false, 0).scan(paths, func(batch uploadScanBatch) error {
+		supportedFiles = append(supportedFiles, batch.paths...)
+		filtered = append(filtered, batch.warnings...)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return supportedFiles, nil
+	return supportedFiles, filtered, nil
 }
 
 func canonicalUploadPath(path string) string {
@@ -536,41 +587,56 @@ func canonicalUploadPath(path string) string {
 
 // UploadFile is an exported version for CLI use with callback
 func UploadFile(ctx context.Context, api *Api, filePath string, workerID int, callback ProgressCallback) (string, error) {
-	return uploadFileWithCallback(ctx, api, filePath, workerID, callback)
+	return uploadFileWithCallback(ctx, api, credentialEmail(api.authData), filePath, mediaFormat(filePath), nil, workerID, callback)
 }
 
-func uploadFileWithCallback(ctx context.Context, api *Api, filePath string, workerID int, callback ProgressCallback) (string, error) {
+// uploadFileWithCallback uploads filePath, whose mediaFormat is format, with
+// api, the client of account.
+func uploadFileWithCallback(ctx context.Context, api *Api, account string, filePath string, format string, hashes preparedHashes, workerID int, callback ProgressCallback) (string, error) {
 	fileName := filepath.Base(filePath)
 	mediakey := ""
 
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error getting file info: %w", err)
+	}
+
 	// Determine the timestamp to use for the upload.
 	// Default to file mtime, but allow filename-based timestamp to take precedence if enabled.
-	var uploadTimestamp int64
-	if info, err := os.Stat(filePath); err == nil {
-		uploadTimestamp = info.ModTime().Unix()
-	}
+	uploadTimestamp := fileInfo.ModTime().Unix()
 	if AppConfig.SetDateFromFilename {
 		if t, ok := parseTimestampFromFilename(filePath); ok {
 			uploadTimestamp = t.Unix()
 		}
 	}
 
-	// Stage 1: Hashing
-	callback("ThreadStatus", ThreadStatus{
-		WorkerID: workerID,
-		Status:   "hashing",
-		FilePath: filePath,
-		FileName: fileName,
-		Message:  "Hashing...",
-	})
+	_, prepared := hashes.lookup(filePath, fileInfo)
+	if !prepared && hashWhileUploadEligible(account, filePath, fileInfo) {
+		mediaKey, err := uploadFileHashingWhileSending(ctx, api, account, filePath, format, fileInfo, uploadTimestamp, workerID, callback)
+		if !errors.Is(err, errUploadHashRequired) {
+			return mediaKey, err
+		}
+		// The server wants the hash up front; use two passes for this
+		// account from now on.
+		hashWhileUploadUnsupported.Store(account, true)
+	}
 
-	sha1_hash_bytes, err := CalculateSHA1(ctx, filePath)
+	// Stage 1: Hashing, unless the hashing stage already did
+	if !prepared {
+		callback("ThreadStatus", ThreadStatus{
+			WorkerID: workerID,
+			Status:   "hashing",
+			FilePath: filePath,
+			FileName: fileName,
+			Message:  "Hashing...",
+		})
+	}
+
+	sha1_hash_bytes, err := hashes.hash(ctx, filePath, fileInfo)
 	if err != nil {
 		return "", fmt.Errorf("error calculating hash file: %w", err)
 	}
 
-	sha1_hash_b64 := base64.StdEncoding.EncodeToString([]byte(sha1_hash_bytes))
-
 	// Stage 2: Checking if exists in library
 	if !AppConfig.ForceUpload {
 		callback("ThreadStatus", ThreadStatus{
@@ -581,7 +647,7 @@ func uploadFileWithCallback(ctx context.Context, api *Api, filePath string, work
 			Message:  "Checking if file exists in library...",
 		})
 
-		mediakey, err = api.FindRemoteMediaByHash(sha1_hash_bytes)
+		mediakey, err = hashes.findRemote(ctx, api, filePath, fileInfo, sha1_hash_bytes)
 		if err != nil {
 			// Non-fatal: log via callback and continue with upload
 			callback("ThreadStatus", ThreadStatus{
@@ -592,30 +658,12 @@ func uploadFileWithCallback(ctx context.Context, api *Api, filePath string, work
 				Message:  fmt.Sprintf("Hash check warning: %v, proceeding with upload", err),
 			})
 		}
-		if len(mediakey) > 0 {
-			callback("ThreadStatus", ThreadStatus{
-				WorkerID: workerID,
-				Status:   "completed",
-				FilePath: filePath,
-				FileName: fileName,
-				Message:  "Already in library",
-			})
-			if AppConfig.DeleteFromHost {
-				if err := os.Remove(filePath); err != nil {
-					return mediakey, fmt.Errorf("file exists in library but failed to delete local copy: %w", err)
-				}
-			}
-			return mediakey, nil
-		}
 	}
-
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		return "", fmt.Errorf("error getting file info: %w", err)
+	if len(mediakey) > 0 {
+		return keepExistingMedia(ctx, api, filePath, sha1_hash_bytes, mediakey, workerID, callback)
 	}
 
 	// Stage 3: Uploading
-	fileSize := fileInfo.Size()
 	callback("ThreadStatus", ThreadStatus{
 		WorkerID:      workerID,
 		Status:        "uploading",
@@ -623,16 +671,21 @@ func uploadFileWithCallback(ctx context.Context, api *Api, filePath string, work
 		FileName:      fileName,
 		Message:       "Uploading...",
 		BytesUploaded: 0,
-		BytesTotal:    fileSize,
+		BytesTotal:    fileInfo.Size(),
 	})
 
-	token, err := api.GetUploadToken(sha1_hash_b64, fileSize)
+	finalizeToken, err := uploadWithResumableSession(ctx, api, account, filePath, fileInfo, sha1_hash_bytes, uploadProgressCallback(filePath, workerID, callback))
 	if err != nil {
 		return "", fmt.Errorf("error uploading file: %w", err)
 	}
+	return commitUploadedFile(ctx, api, account, filePath, format, fileInfo, sha1_hash_bytes, finalizeToken, uploadTimestamp, workerID, callback)
+}
 
-	// Create progress callback for upload
-	progressCallback := func(bytesUploaded, bytesTotal int64, attempt int) {
+// uploadProgressCallback reports transfer progress of filePath as thread
+// status updates.
+func uploadProgressCallback(filePath string, workerID int, callback ProgressCallback) UploadProgressCallback {
+	fileName := filepath.Base(filePath)
+	return func(bytesUploaded, bytesTotal int64, attempt int) {
 		message := "Uploading..."
 		if attempt > 1 {
 			message = fmt.Sprintf("Retrying... (attempt %d)", attempt)
@@ -648,11 +701,29 @@ func uploadFileWithCallback(ctx context.Context, api *Api, filePath string, work
 			Attempt:       attempt,
 		})
 	}
+}
 
-	finalizeToken, err := api.UploadFileWithProgress(ctx, filePath, token, progressCallback)
-	if err != nil {
-		return "", fmt.Errorf("error uploading file: %w", err)
+// keepExistingMedia reports a file that is already in the library and, with
+// DeleteFromHost, removes the local copy.
+func keepExistingMedia(ctx context.Context, api *Api, filePath string, hash []byte, mediaKey string, workerID int, callback ProgressCallback) (string, error) {
+	callback("ThreadStatus", ThreadStatus{
+		WorkerID: workerID,
+		Status:   "completed",
+		FilePath: filePath,
+		FileName: filepath.Base(filePath),
+		Message:  "Already in library",
+	})
+	if AppConfig.DeleteFromHost {
+		if err := removeUploadedFiles(ctx, api, currentLocalDeletePolicy(), mediaKey, localFile{Path: filePath, SHA1: hash}); err != nil {
+			return mediaKey, fmt.Errorf("file exists in library but failed to delete local copy: %w", err)
+		}
 	}
+	return mediaKey, nil
+}
+
+// commitUploadedFile turns a finished transfer into a library item and, with
+// DeleteFromHost, removes the local copy.
+func commitUploadedFile(ctx context.Context, api *Api, account string, filePath string, format string, fileInfo os.FileInfo, hash []byte, finalizeToken ScottyFinalizeToken, uploadTimestamp int64, workerID int, callback ProgressCallback) (string, error) {
 	commitToken, err := finalizeToken.legacyCommitToken()
 	if err != nil {
 		return "", fmt.Errorf("error decoding upload finalize token: %w", err)
@@ -663,11 +734,11 @@ func uploadFileWithCallback(ctx context.Context, api *Api, filePath string, work
 		WorkerID: workerID,
 		Status:   "finalizing",
 		FilePath: filePath,
-		FileName: fileName,
+		FileName: filepath.Base(filePath),
 		Message:  "Committing upload...",
 	})
 
-	mediaKey, err := api.CommitUpload(commitToken, fileInfo.Name(), sha1_hash_bytes, uploadTimestamp)
+	mediaKey, err := api.CommitUpload(ctx, commitToken, uploadFileName(fileInfo.Name(), format), hash, uploadTimestamp)
 	if err != nil {
 		return "", fmt.Errorf("error committing file: %w", err)
 	}
@@ -677,7 +748,7 @@ func uploadFileWithCallback(ctx context.Context, api *Api, filePath string, work
 	}
 
 	if AppConfig.DeleteFromHost {
-		if err := os.Remove(filePath); err != nil {
+		if err := removeUploadedFiles(ctx, api, currentLocalDeletePolicy(), mediaKey, localFile{Path: filePath, SHA1: hash}); err != nil {
 			return mediaKey, fmt.Errorf("uploaded successfully but failed to delete file: %w", err)
 		}
 	}
@@ -685,7 +756,7 @@ func uploadFileWithCallback(ctx context.Context, api *Api, filePath string, work
 	return mediaKey, nil
 }
 
-func startUploadWorker(workerID int, workChan <-chan UploadWorkItem, results chan<- FileUploadResult, cancel <-chan struct{}, wg *sync.WaitGroup, app AppInterface) {
+func startUploadWorker(workerID int, workChan <-chan UploadWorkItem, results chan<- FileUploadResult, cancel <-chan struct{}, stop <-chan struct{}, notAttempted *atomic.Bool, wg *sync.WaitGroup, app AppInterface) {
 	defer wg.Done()
 
 	// Emit idle status initially
@@ -695,16 +766,8 @@ func startUploadWorker(workerID int, workChan <-chan UploadWorkItem, results cha
 		Message:  "Waiting for files...",
 	})
 
-	// Create API client once per worker for connection reuse
-	api, err := NewApi()
-	if err != nil {
-		app.EmitEvent("ThreadStatus", ThreadStatus{
-			WorkerID: workerID,
-			Status:   "error",
-			Message:  fmt.Sprintf("Failed to initialize API: %v", err),
-		})
-		return
-	}
+	// Create API clients once per worker for connection reuse
+	apis := make(accountApis)
 
 	// Create callback from app interface (reuse for all files)
 	callback := func(event string, data any) {
@@ -720,6 +783,9 @@ func startUploadWorker(workerID int, workChan <-chan UploadWorkItem, results cha
 				Message:  "Cancelled",
 			})
 			return // Stop if cancellation is requested
+		case <-stop:
+			// The failure limit was reached; drain the queue without uploading.
+			notAttempted.Store(true)
 		default:
 			ctx, cancelUpload := context.WithCancel(context.Background())
 			go func() {
@@ -734,9 +800,31 @@ func startUploadWorker(workerID int, workChan <-chan UploadWorkItem, results cha
 			path := uploadWorkPrimaryPath(item)
 			paths := uploadWorkPaths(item)
 			isLivePhoto := item.Kind == UploadWorkLivePhoto
-			mediaKey, skipped, err := uploadWorkItem(ctx, api, item, workerID, callback)
+			// Stat before the upload, which may delete the file.
+			info, statErr := os.Stat(path)
+			var mediaKey string
+			var skipped bool
+			api, err := apis.get(item.account)
+			if err != nil {
+				err = fmt.Errorf("failed to initialize API: %w", err)
+			} else if err = uploadCongestion.acquire(ctx, func() {
+				app.EmitEvent("ThreadStatus", ThreadStatus{
+					WorkerID: workerID,
+					Status:   "idle",
+					FilePath: path,
+					FileName: filepath.Base(path),
+					Message:  "Waiting for the server or a free upload slot...",
+				})
+			}); err == nil {
+				mediaKey, skipped, err = uploadWorkItem(ctx, api, item, workerID, callback)
+				uploadCongestion.release()
+			}
+			var hash []byte
+			if statErr == nil {
+				hash, _ = lookupHashCache(path, info)
+			}
 			if err != nil && mediaKey != "" {
-				results <- FileUploadResult{IsLivePhoto: isLivePhoto, Path: path, Paths: paths, MediaKey: mediaKey}
+				results <- FileUploadResult{IsLivePhoto: isLivePhoto, Path: path, Paths: paths, MediaKey: mediaKey, Account: item.account, album: item.album, sha1: hash}
 				app.EmitEvent("uploadWarning", PreflightWarning{
 					Paths:   paths,
 					Code:    "local-cleanup-failed",
@@ -750,7 +838,7 @@ func startUploadWorker(workerID int, workChan <-chan UploadWorkItem, results cha
 					Message:  fmt.Sprintf("Uploaded, but local cleanup failed: %v", err),
 				})
 			} else if err != nil {
-				results <- FileUploadResult{IsError: true, IsLivePhoto: isLivePhoto, Error: err, ErrorMessage: err.Error(), Path: path, Paths: paths}
+				results <- FileUploadResult{IsError: true, IsLivePhoto: isLivePhoto, Error: err, ErrorMessage: err.Error(), Path: path, Paths: paths, Account: item.account, sha1: hash}
 				app.EmitEvent("ThreadStatus", ThreadStatus{
 					WorkerID: workerID,
 					Status:   "error",
@@ -772,9 +860,11 @@ func startUploadWorker(workerID int, workChan <-chan UploadWorkItem, results cha
 					SkipReason:  skipReason,
 					Path:        path,
 					Paths:       paths,
+					Account:     item.account,
+					sha1:        hash,
 				}
 			} else {
-				results <- FileUploadResult{IsLivePhoto: isLivePhoto, Path: path, Paths: paths, MediaKey: mediaKey}
+				results <- FileUploadResult{IsLivePhoto: isLivePhoto, Path: path, Paths: paths, MediaKey: mediaKey, Account: item.account, album: item.album, sha1: hash}
 				app.EmitEvent("ThreadStatus", ThreadStatus{
 					WorkerID: workerID,
 					Status:   "completed",
@@ -808,7 +898,7 @@ func uploadWorkItem(ctx context.Context, api *Api, item UploadWorkItem, workerID
 		if item.Single == nil || item.LivePhoto != nil {
 			return "", false, fmt.Errorf("invalid single-media work item")
 		}
-		mediaKey, err := uploadFileWithCallback(ctx, api, item.Single.Path, workerID, callback)
+		mediaKey, err := uploadFileWithCallback(ctx, api, item.account, item.Single.Path, item.formats.of(item.Single.Path), item.hashes, workerID, callback)
 		return mediaKey, false, err
 	case UploadWorkLivePhoto:
 		if item.LivePhoto == nil || item.Single != nil {
@@ -817,8 +907,12 @@ func uploadWorkItem(ctx context.Context, api *Api, item UploadWorkItem, workerID
 		return uploadLivePhotoWithCallback(ctx, api, *item.LivePhoto, LivePhotoUploadOptions{
 			Policy:                     buildLivePhotoCommitPolicy(api, AppConfig),
 			DeleteFromHost:             AppConfig.DeleteFromHost,
+			DeletePolicy:               currentLocalDeletePolicy(),
 			SetDateFromFilename:        AppConfig.SetDateFromFilename,
 			UpdateExistingPhotosToLive: AppConfig.UpdateExistingPhotosToLive,
+			account:                    item.account,
+			formats:                    item.formats,
+			hashes:                     item.hashes,
 		}, workerID, callback)
 	default:
 		return "", false, fmt.Errorf("unsupported upload work kind %q", item.Kind)
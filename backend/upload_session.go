@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"time"
+)
+
+// uploadSessionMaxAge bounds how long a persisted Scotty upload ID is offered
+// for resumption. The server may expire it sooner; that case is detected by
+// the offset query and falls back to a fresh token.
+const uploadSessionMaxAge = 7 * 24 * time.Hour
+
+type resumableUploadAPI interface {
+	GetUploadToken(sha1Hash string, fileSize int64) (string, error)
+	UploadFileWithProgress(ctx context.Context, filePath string, uploadToken string, onProgress UploadProgressCallback) (ScottyFinalizeToken, error)
+	ResumeUploadFileWithProgress(ctx context.Context, filePath string, uploadToken string, onProgress UploadProgressCallback) (ScottyFinalizeToken, error)
+}
+
+// uploadWithResumableSession transfers filePath, reusing the upload ID of an
+// earlier interrupted transfer of the same content to account when one was
+// persisted. Upload IDs belong to the account that requested them.
+// The upload ID is recorded before any bytes are sent and removed only after
+// the server returns a finalize token, so a killed process can pick it up.
+func uploadWithResumableSession(
+	ctx context.Context,
+	api resumableUploadAPI,
+	account string,
+	filePath string,
+	info os.FileInfo,
+	hash []byte,
+	onProgress UploadProgressCallback,
+) (ScottyFinalizeToken, error) {
+	if uploadID, ok := loadUploadSession(account, filePath, info, hash); ok {
+		token, err := api.ResumeUploadFileWithProgress(ctx, filePath, uploadID, onProgress)
+		if err == nil {
+			deleteUploadSession(account, filePath)
+			return token, nil
+		}
+		if !errors.Is(err, errUploadSessionExpired) {
+			return ScottyFinalizeToken{}, err
+		}
+		deleteUploadSession(account, filePath)
+	}
+
+	uploadID, err := api.GetUploadToken(base64.StdEncoding.EncodeToString(hash), info.Size())
+	if err != nil {
+		return ScottyFinalizeToken{}, err
+	}
+	saveUploadSession(account, filePath, info, hash, uploadID)
+
+	token, err := api.UploadFileWithProgress(ctx, filePath, uploadID, onProgress)
+	if err != nil {
+		if errors.Is(err, errUploadSessionExpired) {
+			deleteUploadSession(account, filePath)
+		}
+		return ScottyFinalizeToken{}, err
+	}
+	deleteUploadSession(account, filePath)
+	return token, nil
+}
+
+// loadUploadSession returns a persisted upload ID only when the file identity
+// and content hash still match what was originally announced to the server.
+func loadUploadSession(account string, filePath string, info os.FileInfo, hash []byte) (string, bool) {
+	db, err := openStateDB()
+	if err != nil {
+		return "", false
+	}
+	var (
+		size      int64
+		mtime     int64
+		storedSHA []byte
+		uploadID  string
+		createdAt int64
+	)
+	err = db.QueryRow(
+		`SELECT size, mtime_ns, sha1, upload_id, created_at FROM upload_sessions WHERE path = ? AND account = ?`,
+		canonicalUploadPath(filePath),
+		account,
+	).Scan(&size, &mtime, &storedSHA, &uploadID, &createdAt)
+	if err != nil {
+		// sql.ErrNoRows is the common case; any other read failure is treated the
+		// same way so a damaged state database never blocks an upload.
+		return "", false
+	}
+	if size != info.Size() || mtime != info.ModTime().UnixNano() || !bytes.Equal(storedSHA, hash) ||
+		time.Since(time.Unix(createdAt, 0)) > uploadSessionMaxAge {
+		deleteUploadSession(account, filePath)
+		return "", false
+	}
+	return uploadID, true
+}
+
+func saveUploadSession(account string, filePath string, info os.FileInfo, hash []byte, uploadID string) {
+	db, err := openStateDB()
+	if err != nil {
+		return
+	}
+	_, _ = db.Exec(
+		`INSERT OR REPLACE INTO upload_sessions (path, account, size, mtime_ns, sha1, upload_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		canonicalUploadPath(filePath),
+		account,
+		info.Size(),
+		info.ModTime().UnixNano(),
+		hash,
+		uploadID,
+		time.Now().Unix(),
+	)
+}
+
+func deleteUploadSession(account string, filePath string) {
+	db, err := openStateDB()
+	if err != nil {
+		return
+	}
+	_, _ = db.Exec(`DELETE FROM upload_sessions WHERE path = ? AND account = ?`, canonicalUploadPath(filePath), account)
+}
@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Skip codes reported for files removed by UploadFilters.
+const (
+	SkipCodeFilteredSize         = "filtered-size"
+	SkipCodeFilteredModified     = "filtered-modified-time"
+	SkipCodeFilteredFilenameDate = "filtered-filename-date"
+	SkipCodeFilteredMediaClass   = "filtered-media-class"
+)
+
+// Media classes accepted by UploadFilters.MediaClasses.
+const (
+	MediaClassPhoto = "photo"
+	MediaClassVideo = "video"
+	MediaClassRaw   = "raw"
+)
+
+// UploadFilters narrows the files an upload picks up. Zero values disable a
+// filter. Lower bounds are inclusive and upper bounds exclusive.
+type UploadFilters struct {
+	MinSize int64
+	MaxSize int64
+	// ModifiedAfter and ModifiedBefore compare the file mtime.
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// FilenameDateAfter and FilenameDateBefore compare the date parsed from
+	// the file name. Files without a recognizable date are filtered out.
+	FilenameDateAfter  time.Time
+	FilenameDateBefore time.Time
+	MediaClasses       []string
+}
+
+func (f UploadFilters) active() bool {
+	return f.MinSize > 0 || f.MaxSize > 0 ||
+		!f.ModifiedAfter.IsZero() || !f.ModifiedBefore.IsZero() ||
+		!f.FilenameDateAfter.IsZero() || !f.FilenameDateBefore.IsZero() ||
+		len(f.MediaClasses) > 0
+}
+
+// check returns a skip warning for path when it does not pass the filters.
+// format is the mediaFormat of path, which is only needed for MediaClasses.
+func (f UploadFilters) check(path string, info os.FileInfo, format string) (PreflightWarning, bool) {
+	skip := func(code string, format string, args ...any) (PreflightWarning, bool) {
+		return PreflightWarning{Paths: []string{path}, Code: code, Message: fmt.Sprintf(format, args...)}, true
+	}
+
+	if len(f.MediaClasses) > 0 {
+		class := supportedFormats[format]
+		if !slices.Contains(f.MediaClasses, class) {
+			if class == "" {
+				class = "unknown"
+			}
+			return skip(SkipCodeFilteredMediaClass, "media class %s is not one of %s", class, strings.Join(f.MediaClasses, ", "))
+		}
+	}
+	if f.MinSize > 0 && info.Size() < f.MinSize {
+		return skip(SkipCodeFilteredSize, "size %d bytes is below the minimum of %d", info.Size(), f.MinSize)
+	}
+	if f.MaxSize > 0 && info.Size() >= f.MaxSize {
+		return skip(SkipCodeFilteredSize, "size %d bytes is not below the maximum of %d", info.Size(), f.MaxSize)
+	}
+	modTime := info.ModTime()
+	if !f.ModifiedAfter.IsZero() && modTime.Before(f.ModifiedAfter) {
+		return skip(SkipCodeFilteredModified, "modified %s, before %s", modTime.Format(time.DateTime), f.ModifiedAfter.Format(time.DateTime))
+	}
+	if !f.ModifiedBefore.IsZero() && !modTime.Before(f.ModifiedBefore) {
+		return skip(SkipCodeFilteredModified, "modified %s, not before %s", modTime.Format(time.DateTime), f.ModifiedBefore.Format(time.DateTime))
+	}
+	if !f.FilenameDateAfter.IsZero() || !f.FilenameDateBefore.IsZero() {
+		date, ok := parseTimestampFromFilename(path)
+		switch {
+		case !ok:
+			return skip(SkipCodeFilteredFilenameDate, "no date found in the file name")
+		case !f.FilenameDateAfter.IsZero() && date.Before(f.FilenameDateAfter):
+			return skip(SkipCodeFilteredFilenameDate, "file name date %s is before %s", date.Format(time.DateTime), f.FilenameDateAfter.Format(time.DateTime))
+		case !f.FilenameDateBefore.IsZero() && !date.Before(f.FilenameDateBefore):
+			return skip(SkipCodeFilteredFilenameDate, "file name date %s is not before %s", date.Format(time.DateTime), f.FilenameDateBefore.Format(time.DateTime))
+		}
+	}
+	return PreflightWarning{}, false
+}
+
+func isUploadFilterSkipCode(code string) bool {
+	switch code {
+	case SkipCodeFilteredSize, SkipCodeFilteredModified, SkipCodeFilteredFilenameDate, SkipCodeFilteredMediaClass:
+		return true
+	}
+	return false
+}
+
+var byteSizeUnits = map[string]int64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "tib": 1 << 40,
+}
+
+// ParseByteSize parses sizes like 500, 200K, 1.5MB or 4G. Units are binary.
+func ParseByteSize(value string) (int64, error) {
+	text := strings.ToLower(strings.TrimSpace(value))
+	split := strings.IndexFunc(text, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if split < 0 {
+		split = len(text)
+	}
+	multiplier, ok := byteSizeUnits[strings.TrimSpace(text[split:])]
+	amount, err := strconv.ParseFloat(text[:split], 64)
+	if !ok || err != nil || amount < 0 {
+		return 0, fmt.Errorf("invalid size %q, use a number with an optional K, M, G or T suffix", value)
+	}
+	return int64(amount * float64(multiplier)), nil
+}
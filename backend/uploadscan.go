@@ -0,0 +1,469 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// uploadScanChunkSize caps a batch when Live Photo pairing is off, so files
+// from a large flat directory reach the workers before the directory is done.
+const uploadScanChunkSize = 256
+
+// uploadScanQueueSize is how many batches the scanner may run ahead of the
+// workers.
+const uploadScanQueueSize = 4
+
+// uploadScanBatch holds files that passed filtering, plus the skip warnings
+// for the ones that did not. Apart from explicit file arguments, a batch never
+// spans directories, so it can be classified on its own.
+type uploadScanBatch struct {
+	paths []string
+	// formats holds the formats the scan detected. Paths missing from it
+	// were not read.
+	formats  mediaFormats
+	warnings []PreflightWarning
+}
+
+// scanOrigin is how the scanner reached a file.
+type scanOrigin int
+
+const (
+	// scanOriginWalk is a regular file found while walking a directory.
+	scanOriginWalk scanOrigin = iota
+	// scanOriginLink is a symlink found while walking a directory.
+	scanOriginLink
+	// scanOriginArgument is a file passed to scan.
+	scanOriginArgument
+)
+
+// scanFileKey identifies a file by device and inode where the platform
+// provides them, and by its resolved path elsewhere.
+type scanFileKey struct {
+	device uint64
+	inode  uint64
+	path   string
+}
+
+func scanFileKeyOf(path string, info os.FileInfo) scanFileKey {
+	if device, inode, ok := fileDeviceInode(info); ok {
+		return scanFileKey{device: device, inode: inode}
+	}
+	canonicalPath := canonicalUploadPath(path)
+	if runtime.GOOS == "windows" {
+		canonicalPath = strings.ToLower(canonicalPath)
+	}
+	return scanFileKey{path: canonicalPath}
+}
+
+// uploadScanner walks the upload paths and hands files over one directory at
+// a time, so that the caller can work on the first directory while the rest
+// of the tree is still being read.
+type uploadScanner struct {
+	cancelled func() bool
+	// validate runs the preflight checks of validateUploadFile on every file.
+	validate bool
+	// chunkSize splits directories into smaller batches. 0 keeps every
+	// directory together, which Live Photo pairing needs.
+	chunkSize int
+
+	// roots are the resolved directory arguments of the running scan.
+	roots []string
+	// trackDirectories remembers every directory entered, which is needed
+	// when directory arguments may overlap or symlinks are followed.
+	trackDirectories bool
+
+	mu sync.Mutex
+	// seen holds the files that can be reached twice, see markSeen.
+	seen    map[scanFileKey]bool
+	visited map[string]bool
+}
+
+func newUploadScanner(cancelled func() bool, validate bool, chunkSize int) *uploadScanner {
+	return &uploadScanner{
+		cancelled: cancelled,
+		validate:  validate,
+		chunkSize: chunkSize,
+		seen:      make(map[scanFileKey]bool),
+		visited:   make(map[string]bool),
+	}
+}
+
+func (s *uploadScanner) isCancelled() bool {
+	return s.cancelled != nil && s.cancelled()
+}
+
+// scan calls emit for every non-empty batch. emit returns context.Canceled to
+// stop the scan.
+func (s *uploadScanner) scan(paths []string, emit func(uploadScanBatch) error) error {
+	// Check every argument up front so a typo fails before anything uploads.
+	infos := make([]os.FileInfo, len(paths))
+	for i, path := range paths {
+		if s.isCancelled() {
+			return context.Canceled
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("error accessing path %s: %w", path, err)
+		}
+		infos[i] = info
+	}
+
+	// Explicit files form one batch so that a Live Photo passed as two
+	// arguments is paired even across directories.
+	var files uploadScanBatch
+	for i, path := range paths {
+		if infos[i].IsDir() {
+			continue
+		}
+		if s.isCancelled() {
+			return context.Canceled
+		}
+		if err := s.add(&files, path, infos[i], scanOriginArgument, emit); err != nil {
+			return err
+		}
+	}
+	if err := s.flush(&files, emit); err != nil {
+		return err
+	}
+
+	for i, path := range paths {
+		if infos[i].IsDir() {
+			s.roots = append(s.roots, canonicalUploadPath(path))
+		}
+	}
+	s.trackDirectories = AppConfig.FollowSymlinks || len(s.roots) > 1
+	for i, path := range paths {
+		if !infos[i].IsDir() {
+			continue
+		}
+		filter, err := newScanFilter(path, AppConfig.ExcludePatterns, AppConfig.IncludePatterns, AppConfig.ExcludePattern)
+		if err != nil {
+			return err
+		}
+		if err := s.walk(path, filter, emit); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			return fmt.Errorf("error scanning directory %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// scanDirectoryJob is one directory waiting to be read by walk.
+type scanDirectoryJob struct {
+	path   string
+	filter *scanFilter
+	depth  int
+}
+
+// walk scans root and, when recursive, its subdirectories, reading up to
+// AppConfig.ScanThreads directories at a time. Listing a directory on SMB or
+// NFS mounts is latency bound, so several requests in flight hide most of it.
+// Only an unreadable root is an error; unreadable subdirectories are skipped.
+func (s *uploadScanner) walk(root string, filter *scanFilter, emit func(uploadScanBatch) error) error {
+	var emitMu sync.Mutex
+	serialEmit := func(batch uploadScanBatch) error {
+		emitMu.Lock()
+		defer emitMu.Unlock()
+		return emit(batch)
+	}
+
+	var (
+		mu      sync.Mutex
+		wake    = sync.NewCond(&mu)
+		queue   = []scanDirectoryJob{{path: root, filter: filter}}
+		active  int
+		failure error
+	)
+	work := func() {
+		for {
+			mu.Lock()
+			for len(queue) == 0 && active > 0 && failure == nil {
+				wake.Wait()
+			}
+			if len(queue) == 0 || failure != nil {
+				mu.Unlock()
+				wake.Broadcast()
+				return
+			}
+			// Taking the newest job walks depth first, which keeps the queue
+			// short on wide trees.
+			job := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			active++
+			mu.Unlock()
+
+			subdirectories, err := s.scanDirectory(job, serialEmit)
+
+			mu.Lock()
+			active--
+			switch {
+			case err == nil:
+				for i := len(subdirectories) - 1; i >= 0; i-- {
+					queue = append(queue, subdirectories[i])
+				}
+			case errors.Is(err, context.Canceled), job.depth == 0:
+				if failure == nil {
+					failure = err
+				}
+			}
+			mu.Unlock()
+			wake.Broadcast()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for range max(AppConfig.ScanThreads, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	wg.Wait()
+	return failure
+}
+
+// scanDirectory emits the files of one directory and returns the
+// subdirectories to scan next, so uploads start with the first directory
+// instead of after the whole tree has been read.
+func (s *uploadScanner) scanDirectory(job scanDirectoryJob, emit func(uploadScanBatch) error) ([]scanDirectoryJob, error) {
+	if s.isCancelled() {
+		return nil, context.Canceled
+	}
+	if s.trackDirectories && !s.markVisited(job.path) {
+		return nil, nil // symlink loop, a directory linked twice or scanned by another argument
+	}
+	entries, err := os.ReadDir(job.path)
+	if err != nil {
+		return nil, err
+	}
+	filter := job.filter.enter(job.path)
+	descend := AppConfig.Recursive && (AppConfig.MaxDepth <= 0 || job.depth < AppConfig.MaxDepth)
+
+	var batch uploadScanBatch
+	var subdirectories []scanDirectoryJob
+	for _, entry := range entries {
+		if s.isCancelled() {
+			return nil, context.Canceled
+		}
+		fullPath := filepath.Join(job.path, entry.Name())
+		isDir := entry.IsDir()
+		origin := scanOriginWalk
+		if entry.Type()&os.ModeSymlink != 0 {
+			origin = scanOriginLink
+			info, err := os.Stat(fullPath)
+			if err != nil {
+				continue // dangling link
+			}
+			if info.IsDir() {
+				if !AppConfig.FollowSymlinks {
+					continue
+				}
+				isDir = true
+			}
+		}
+		if filter.excluded(fullPath, isDir) {
+			continue
+		}
+		if isDir {
+			if descend {
+				subdirectories = append(subdirectories, scanDirectoryJob{path: fullPath, filter: filter, depth: job.depth + 1})
+			}
+		} else if entry.Name() != ignoreFileName && filter.included(fullPath) {
+			if err := s.add(&batch, fullPath, nil, origin, emit); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s.flush(&batch, emit); err != nil {
+		return nil, err
+	}
+	return subdirectories, nil
+}
+
+// add puts path into batch, or a skip warning for it when it is filtered out
+// or fails validation. Unsupported files and duplicates are dropped silently.
+func (s *uploadScanner) add(batch *uploadScanBatch, path string, info os.FileInfo, origin scanOrigin, emit func(uploadScanBatch) error) error {
+	// The filter reads every header, so that a known extension cannot pass
+	// off content that is not media; without it the header is read only when
+	// something needs the format.
+	format, detected, read := "", false, false
+	if s.validate || len(AppConfig.Filters.MediaClasses) > 0 || !AppConfig.DisableUnsupportedFilesFilter {
+		format, read = scanMediaFormat(path)
+		detected = true
+	}
+	unrecognized := false
+	if !AppConfig.DisableUnsupportedFilesFilter && detected && format == "" {
+		// Unknown extensions are not media; known ones are reported unless
+		// the file could not be read, which the upload reports instead.
+		if supportedFormats[extensionFormat(path)] == "" {
+			return nil
+		}
+		unrecognized = read
+	}
+	if info == nil {
+		info, _ = os.Stat(path)
+	}
+	if !s.markSeen(path, info, origin) {
+		return nil
+	}
+	if info != nil && AppConfig.Filters.active() {
+		if warning, skip := AppConfig.Filters.check(path, info, format); skip {
+			batch.warnings = append(batch.warnings, warning)
+			return nil
+		}
+	}
+	if s.validate {
+		if warning, skip := validateUploadFile(path, format); skip {
+			batch.warnings = append(batch.warnings, warning)
+			return nil
+		}
+	}
+	if unrecognized {
+		batch.warnings = append(batch.warnings, PreflightWarning{
+			Paths:   []string{path},
+			Code:    SkipCodeUnrecognizedContent,
+			Message: fmt.Sprintf("Skipped because its content is not a recognized .%s file", extensionFormat(path)),
+		})
+		return nil
+	}
+	batch.paths = append(batch.paths, path)
+	if detected {
+		if batch.formats == nil {
+			batch.formats = make(mediaFormats)
+		}
+		batch.formats[path] = format
+	}
+	if s.chunkSize > 0 && len(batch.paths)+len(batch.warnings) >= s.chunkSize {
+		return s.flush(batch, emit)
+	}
+	return nil
+}
+
+func (s *uploadScanner) flush(batch *uploadScanBatch, emit func(uploadScanBatch) error) error {
+	if len(batch.paths) == 0 && len(batch.warnings) == 0 {
+		return nil
+	}
+	err := emit(*batch)
+	*batch = uploadScanBatch{}
+	return err
+}
+
+// markSeen reports whether path is new to this scan. Only files that can be
+// reached twice are remembered: file arguments, which a directory argument
+// may contain as well, and symlinked files. Regular files of a walk are only
+// compared against those, so memory does not grow with the size of the tree.
+// A symlink to a file that the walk reaches anyway is left to the walk.
+func (s *uploadScanner) markSeen(path string, info os.FileInfo, origin scanOrigin) bool {
+	if info == nil {
+		return true // the upload reports the error
+	}
+	if origin == scanOriginLink && s.walkReaches(canonicalUploadPath(path)) {
+		return false
+	}
+	if origin == scanOriginWalk {
+		s.mu.Lock()
+		remembered := len(s.seen) > 0
+		s.mu.Unlock()
+		if !remembered {
+			return true
+		}
+	}
+	// The key may need the resolved path, which costs a round trip per
+	// component on network mounts, so it is built outside the lock.
+	key := scanFileKeyOf(path, info)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen[key] {
+		return false
+	}
+	if origin != scanOriginWalk {
+		s.seen[key] = true
+	}
+	return true
+}
+
+// walkReaches reports whether walking the directory arguments finds the
+// resolved file path, going by recursion and depth but not by filters.
+func (s *uploadScanner) walkReaches(path string) bool {
+	for _, root := range s.roots {
+		relative, err := filepath.Rel(root, path)
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			continue
+		}
+		depth := 0
+		if dir := filepath.Dir(relative); dir != "." {
+			depth = strings.Count(dir, string(filepath.Separator)) + 1
+		}
+		if depth == 0 || (AppConfig.Recursive && (AppConfig.MaxDepth <= 0 || depth <= AppConfig.MaxDepth)) {
+			return true
+		}
+	}
+	return false
+}
+
+// markVisited reports whether dir is entered for the first time. Directories
+// are compared after resolving symlinks, which stops loops when following them.
+func (s *uploadScanner) markVisited(dir string) bool {
+	canonicalPath := canonicalUploadPath(dir)
+	if runtime.GOOS == "windows" {
+		canonicalPath = strings.ToLower(canonicalPath)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.visited[canonicalPath] {
+		return false
+	}
+	s.visited[canonicalPath] = true
+	return true
+}
+
+// uploadScanChunkSizeFor returns the chunk size for the current settings.
+func uploadScanChunkSizeFor(pairLivePhotos bool) int {
+	if pairLivePhotos {
+		return 0
+	}
+	return uploadScanChunkSize
+}
+
+// currentLivePhotoClassification returns the classification options of the
+// current settings.
+func currentLivePhotoClassification(cancelled func() bool) LivePhotoClassificationOptions {
+	return LivePhotoClassificationOptions{
+		Enabled:             AppConfig.PairLivePhotos,
+		SkipIncomplete:      AppConfig.SkipIncompleteLivePhotos,
+		IgnoreAppleMetadata: AppConfig.IgnoreAppleMetadata,
+		Cancelled:           cancelled,
+	}
+}
+
+// collectUploadWork runs the same scan and per-directory classification as
+// an upload, but collects the result instead of streaming it.
+func collectUploadWork(paths []string, cancelled func() bool) ([]UploadWorkItem, []PreflightWarning, error) {
+	var workItems []UploadWorkItem
+	var warnings []PreflightWarning
+	options := currentLivePhotoClassification(cancelled)
+	scanner := newUploadScanner(cancelled, true, uploadScanChunkSizeFor(options.Enabled))
+	err := scanner.scan(paths, func(batch uploadScanBatch) error {
+		items, classifyWarnings := classifyUploadWork(batch.paths, batch.formats, options, nil)
+		workItems = append(workItems, items...)
+		warnings = slices.Concat(warnings, batch.warnings, classifyWarnings)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if cancelled != nil && cancelled() {
+		return nil, nil, context.Canceled
+	}
+	return workItems, warnings, nil
+}
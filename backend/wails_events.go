@@ -14,6 +14,7 @@ func init() {
 	application.RegisterEvent[ThreadStatus]("ThreadStatus")
 	application.RegisterEvent[PreflightWarning]("uploadWarning")
 	application.RegisterEvent[application.Void]("uploadCancel")
+	application.RegisterEvent[UploadBatchTotal]("uploadTotal")
 	application.RegisterEvent[int64]("uploadTotalBytes")
 	application.RegisterEvent[int64]("uploadTotalBytesDelta")
 	application.RegisterEvent[FilesDroppedEvent]("files-dropped")
@@ -0,0 +1,283 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// WatchOptions controls how Watch polls the watched directories.
+type WatchOptions struct {
+	// Interval is the delay between two directory scans.
+	Interval time.Duration
+	// SettleTime is how long a file's size and mtime must stay unchanged
+	// before it is considered fully written.
+	SettleTime time.Duration
+	// PairWindow is how long a Live Photo component is held back waiting for
+	// its partner when PairLivePhotos is enabled. A component still alone
+	// after it is uploaded on its own and marked handled; a partner that
+	// arrives later is uploaded alone too and the two are never paired.
+	PairWindow time.Duration
+}
+
+var DefaultWatchOptions = WatchOptions{
+	Interval:   10 * time.Second,
+	SettleTime: 5 * time.Second,
+	PairWindow: time.Minute,
+}
+
+// watchMaxRetryDelay caps the backoff for files whose upload failed.
+const watchMaxRetryDelay = time.Hour
+
+type watchSignature struct {
+	size    int64
+	modTime time.Time
+}
+
+type watchedFile struct {
+	signature   watchSignature
+	firstSeen   time.Time
+	stableSince time.Time
+}
+
+type directoryWatcher struct {
+	dirs      []string
+	options   WatchOptions
+	cancelled func() bool
+	logger    *slog.Logger
+	pending   map[string]*watchedFile
+	handled   map[string]watchSignature
+	attempts  map[string]int
+}
+
+// Watch polls dirs until ctx is cancelled and uploads every new or changed
+// file once it has settled. Polling instead of filesystem notifications keeps
+// it working on network mounts. Batches go through UploadManager, so hash
+// caching, remote dedup, albums and history behave as for a normal upload.
+func Watch(ctx context.Context, app AppInterface, dirs []string, options WatchOptions) error {
+	if len(dirs) == 0 {
+		return fmt.Errorf("at least one directory is required")
+	}
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("error accessing path %s: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultWatchOptions.Interval
+	}
+	if options.SettleTime < 0 {
+		options.SettleTime = 0
+	}
+	if options.PairWindow < 0 {
+		options.PairWindow = 0
+	}
+
+	w := &directoryWatcher{
+		dirs:      dirs,
+		options:   options,
+		cancelled: func() bool { return ctx.Err() != nil },
+		logger:    app.GetLogger(),
+		pending:   make(map[string]*watchedFile),
+		handled:   make(map[string]watchSignature),
+		attempts:  make(map[string]int),
+	}
+	manager := NewUploadManager(app)
+
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+	for {
+		if batch := w.poll(time.Now()); len(batch) > 0 {
+			failed := w.upload(ctx, manager, app, batch)
+			if ctx.Err() != nil {
+				return nil
+			}
+			w.finishBatch(batch, failed, time.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll rescans the directories and returns the files that are ready to upload.
+func (w *directoryWatcher) poll(now time.Time) []string {
+	// Filtered files are left alone rather than reported on every scan.
+	paths, _, err := filterGooglePhotosFilesWithCancel(w.dirs, w.cancelled)
+	if err != nil {
+		if !w.cancelled() {
+			w.logger.Warn(fmt.Sprintf("watch scan failed: %v", err))
+		}
+		return nil
+	}
+
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		seen[path] = true
+		signature := watchSignature{size: info.Size(), modTime: info.ModTime()}
+		if handled, ok := w.handled[path]; ok {
+			if handled == signature {
+				continue
+			}
+			delete(w.handled, path)
+			delete(w.attempts, path)
+		}
+		file := w.pending[path]
+		if file == nil {
+			w.pending[path] = &watchedFile{signature: signature, firstSeen: now, stableSince: now}
+			continue
+		}
+		if file.signature != signature {
+			file.signature = signature
+			file.stableSince = now
+		}
+	}
+
+	// Forget files that were deleted or moved away, including ones removed by
+	// DeleteFromHost, so a later file with the same name is treated as new.
+	for path := range w.pending {
+		if !seen[path] {
+			delete(w.pending, path)
+		}
+	}
+	for path := range w.handled {
+		if !seen[path] {
+			delete(w.handled, path)
+			delete(w.attempts, path)
+		}
+	}
+
+	ready := make([]string, 0)
+	for path, file := range w.pending {
+		if now.Sub(file.stableSince) >= w.options.SettleTime {
+			ready = append(ready, path)
+		}
+	}
+	slices.Sort(ready)
+	return w.holdUnpairedLivePhotos(ready, now)
+}
+
+// holdUnpairedLivePhotos keeps Live Photo components whose partner has not
+// arrived yet out of the batch until the pair window has passed, so phones
+// that sync the photo and the video separately still produce a pair. Only
+// pending files are considered: a partner already uploaded alone is handled
+// and no longer takes part in pairing.
+func (w *directoryWatcher) holdUnpairedLivePhotos(ready []string, now time.Time) []string {
+	if !AppConfig.PairLivePhotos || w.options.PairWindow == 0 || len(ready) == 0 {
+		return ready
+	}
+	_, warnings := ClassifyUploadWork(ready, LivePhotoClassificationOptions{
+		Enabled:             true,
+		SkipIncomplete:      true,
+		IgnoreAppleMetadata: AppConfig.IgnoreAppleMetadata,
+		Cancelled:           w.cancelled,
+	}, nil)
+
+	held := make(map[string]bool)
+	for _, warning := range warnings {
+		if warning.Code != "incomplete-live-photo-skipped" {
+			continue
+		}
+		for _, path := range warning.Paths {
+			if file := w.pending[path]; file != nil && now.Sub(file.firstSeen) < w.options.PairWindow {
+				held[path] = true
+			}
+		}
+	}
+	if len(held) == 0 {
+		return ready
+	}
+	return slices.DeleteFunc(ready, func(path string) bool { return held[path] })
+}
+
+// upload runs one batch and returns the paths of the items that failed.
+func (w *directoryWatcher) upload(ctx context.Context, manager *UploadManager, app AppInterface, batch []string) map[string]bool {
+	recorder := &watchFailureRecorder{AppInterface: app, failed: make(map[string]bool)}
+	done := make(chan struct{})
+	go func() {
+		manager.Upload(recorder, batch)
+		manager.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		manager.Cancel()
+		<-done
+	}
+	return recorder.failedPaths(batch)
+}
+
+// finishBatch marks uploaded files as handled and schedules failed ones for a
+// retry with exponential backoff.
+func (w *directoryWatcher) finishBatch(batch []string, failed map[string]bool, now time.Time) {
+	for _, path := range batch {
+		file := w.pending[path]
+		if file == nil {
+			continue
+		}
+		if !failed[path] {
+			w.handled[path] = file.signature
+			delete(w.pending, path)
+			delete(w.attempts, path)
+			continue
+		}
+		w.attempts[path]++
+		delay := w.options.Interval << min(w.attempts[path], 10)
+		delay = min(delay, watchMaxRetryDelay)
+		// A future stableSince keeps the file out of the ready set until the
+		// backoff has passed; any change to the file resets it.
+		file.stableSince = now.Add(delay - w.options.SettleTime)
+	}
+}
+
+// watchFailureRecorder forwards every event and remembers which paths failed.
+type watchFailureRecorder struct {
+	AppInterface
+	mu          sync.Mutex
+	failed      map[string]bool
+	batchFailed bool
+}
+
+func (r *watchFailureRecorder) EmitEvent(event string, data any) {
+	if result, ok := data.(FileUploadResult); ok && event == "FileStatus" && result.IsError {
+		r.mu.Lock()
+		if result.Path == "" {
+			// Preflight errors are not tied to a file and fail the whole batch.
+			r.batchFailed = true
+		}
+		r.failed[result.Path] = true
+		for _, path := range result.Paths {
+			r.failed[path] = true
+		}
+		r.mu.Unlock()
+	}
+	r.AppInterface.EmitEvent(event, data)
+}
+
+func (r *watchFailureRecorder) failedPaths(batch []string) map[string]bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.batchFailed {
+		for _, path := range batch {
+			r.failed[path] = true
+		}
+	}
+	return r.failed
+}
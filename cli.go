@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -18,9 +19,18 @@ import (
 // CLI flags and config
 type cliConfig struct {
 	recursive                     bool
+	followSymlinks                bool
+	hashWhileUpload               bool
+	adaptiveThreads               bool
+	limitRate                     string
+	maxDepth                      int
+	scanThreads                   int
 	threads                       int
+	hashThreads                   int
 	forceUpload                   bool
 	deleteFromHost                bool
+	verifyBeforeDelete            bool
+	trashDir                      string
 	disableUnsupportedFilesFilter bool
 	setDateFromFilename           bool
 	pairLivePhotos                bool
@@ -28,18 +38,39 @@ type cliConfig struct {
 	skipIncompleteLivePhotosSet   bool
 	updateExistingPhotosToLive    bool
 	ignoreAppleMetadata           bool
-	excludePattern                string
+	rehash                        bool
+	excludePatterns               []string
+	includePatterns               []string
+	filters                       backend.UploadFilters
 	logLevel                      string
 	configPath                    string
+	account                       string
 	albumName                     string
+	retryFailed                   string
+	output                        string
+	maxFailures                   int
+	dryRun                        bool
 	noTUI                         bool
 }
 
+// Exit codes of the upload command. Usage and setup errors exit with 1.
+const (
+	exitPartialFailure = 2
+	exitTotalFailure   = 3
+	exitAuthFailure    = 4
+	exitCancelled      = 130
+)
+
 // Messages for bubbletea
 type uploadStartMsg struct {
 	total int
 }
 
+type uploadTotalMsg struct {
+	total    int
+	scanning bool
+}
+
 type fileProgressMsg struct {
 	workerID int
 	status   string
@@ -55,6 +86,7 @@ type fileCompleteMsg struct {
 	mediaKey   string
 	skipCode   string
 	skipReason string
+	account    string
 	err        error
 }
 
@@ -88,6 +120,7 @@ type albumErrorMsg struct {
 type uploadModel struct {
 	progress     progress.Model
 	totalFiles   int
+	scanning     bool
 	completed    int
 	failed       int
 	skipped      int
@@ -97,6 +130,8 @@ type uploadModel struct {
 	warnings     []uploadWarning
 	width        int
 	quitting     bool
+	cancelled    bool
+	authFailed   bool
 	// Album state
 	albumName       string
 	albumItemsAdded int
@@ -114,9 +149,20 @@ type uploadResult struct {
 	MediaKey   string   `json:"mediaKey,omitempty"`
 	SkipCode   string   `json:"skipCode,omitempty"`
 	SkipReason string   `json:"skipReason,omitempty"`
+	Account    string   `json:"account,omitempty"`
 	Error      string   `json:"error,omitempty"`
 }
 
+// accountSummary counts the results of one account when routes send files to
+// several accounts.
+type accountSummary struct {
+	Account   string `json:"account"`
+	Total     int    `json:"total"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Skipped   int    `json:"skipped"`
+}
+
 type uploadWarning struct {
 	Paths   []string `json:"paths,omitempty"`
 	Code    string   `json:"code"`
@@ -138,6 +184,10 @@ type uploadSummary struct {
 	Results   []uploadResult  `json:"results"`
 	Warnings  []uploadWarning `json:"warnings,omitempty"`
 	Album     *albumSummary   `json:"album,omitempty"`
+	// Accounts breaks the counts down by account when routes are configured.
+	Accounts []accountSummary `json:"accounts,omitempty"`
+	// Options lets --retry-failed reproduce the album and Live Photo settings.
+	Options *backend.UploadRunOptions `json:"options,omitempty"`
 }
 
 func initialModel() uploadModel {
@@ -164,6 +214,12 @@ func (m uploadModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case uploadStartMsg:
 		m.totalFiles = msg.total
+		m.scanning = true
+		return m, nil
+
+	case uploadTotalMsg:
+		m.totalFiles = msg.total
+		m.scanning = msg.scanning
 		return m, nil
 
 	case fileProgressMsg:
@@ -182,6 +238,7 @@ func (m uploadModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			MediaKey:   msg.mediaKey,
 			SkipCode:   msg.skipCode,
 			SkipReason: msg.skipReason,
+			Account:    msg.account,
 		}
 		if msg.skipped {
 			m.skipped++
@@ -191,6 +248,9 @@ func (m uploadModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.failed++
 			if msg.err != nil {
 				result.Error = msg.err.Error()
+				if errors.Is(msg.err, backend.ErrAuthFailed) {
+					m.authFailed = true
+				}
 			}
 		}
 		m.results = append(m.results, result)
@@ -230,6 +290,7 @@ func (m uploadModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		if msg.String() == "ctrl+c" {
 			m.quitting = true
+			m.cancelled = true
 			return m, tea.Quit
 		}
 	}
@@ -253,7 +314,12 @@ func (m uploadModel) View() string {
 		percent := float64(m.completed+m.failed+m.skipped) / float64(m.totalFiles)
 		b.WriteString(m.progress.ViewAs(percent))
 		fmt.Fprintf(&b, "\n%d/%d items", m.completed+m.failed+m.skipped, m.totalFiles)
+		if m.scanning {
+			b.WriteString(" found so far")
+		}
 		fmt.Fprintf(&b, " (✓ %d success, ↷ %d skipped, ✗ %d failed)\n\n", m.completed, m.skipped, m.failed)
+	} else if m.scanning {
+		b.WriteString("Scanning for files...\n\n")
 	}
 
 	// Worker status
@@ -322,12 +388,13 @@ func parseLogLevel(level string) slog.Level {
 
 func shouldUseTUI(config cliConfig) bool {
 	return !config.noTUI &&
+		config.output != "ndjson" &&
 		term.IsTerminal(os.Stdin.Fd()) &&
 		term.IsTerminal(os.Stdout.Fd())
 }
 
-// CLI upload implementation
-func runCLIUpload(filePaths []string, config cliConfig) error {
+// applyCLIConfig loads the backend config and overrides it with CLI flags.
+func applyCLIConfig(config cliConfig) error {
 	// Set custom config path if provided
 	if config.configPath != "" {
 		backend.ConfigPath = config.configPath
@@ -338,21 +405,68 @@ func runCLIUpload(filePaths []string, config cliConfig) error {
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
+	if err := unlockCredentials(); err != nil {
+		return err
+	}
+	// The account only applies to this command; the selection in the config
+	// file is left alone so that overlapping runs do not interfere.
+	if config.account != "" {
+		email, err := backend.MatchAccount(config.account)
+		if err != nil {
+			return err
+		}
+		backend.AppConfig.Account = email
+	}
 
 	// Override config with CLI flags
 	backend.AppConfig.Recursive = config.recursive
+	// Scan options fall back to the config file when their flags are omitted.
+	if config.followSymlinks {
+		backend.AppConfig.FollowSymlinks = true
+	}
+	if config.maxDepth > 0 {
+		backend.AppConfig.MaxDepth = config.maxDepth
+	}
+	if config.scanThreads > 0 {
+		backend.AppConfig.ScanThreads = config.scanThreads
+	}
 	backend.AppConfig.UploadThreads = config.threads
+	if config.hashThreads > 0 {
+		backend.AppConfig.HashThreads = config.hashThreads
+	}
+	if config.hashWhileUpload {
+		backend.AppConfig.HashWhileUpload = true
+	}
+	if config.adaptiveThreads {
+		backend.AppConfig.AdaptiveThreads = true
+	}
+	if config.limitRate != "" {
+		backend.AppConfig.LimitRate = config.limitRate
+	}
 	backend.AppConfig.ForceUpload = config.forceUpload
 	backend.AppConfig.DeleteFromHost = config.deleteFromHost
+	// The safe delete options only add to the config file, so a trash
+	// directory configured there is kept when the flag is omitted.
+	if config.verifyBeforeDelete {
+		backend.AppConfig.VerifyBeforeDelete = true
+	}
+	if config.trashDir != "" {
+		backend.AppConfig.TrashDir = config.trashDir
+	}
 	backend.AppConfig.DisableUnsupportedFilesFilter = config.disableUnsupportedFilesFilter
 	backend.AppConfig.SetDateFromFilename = config.setDateFromFilename
-	backend.AppConfig.ExcludePattern = config.excludePattern
+	// Patterns from flags are added to the ones in the config file.
+	backend.AppConfig.ExcludePatterns = append(backend.AppConfig.ExcludePatterns, config.excludePatterns...)
+	backend.AppConfig.IncludePatterns = append(backend.AppConfig.IncludePatterns, config.includePatterns...)
 	backend.AppConfig.PairLivePhotos = config.pairLivePhotos
 	if config.skipIncompleteLivePhotosSet {
 		backend.AppConfig.SkipIncompleteLivePhotos = config.skipIncompleteLivePhotos
 	}
 	backend.AppConfig.UpdateExistingPhotosToLive = config.updateExistingPhotosToLive
 	backend.AppConfig.IgnoreAppleMetadata = config.ignoreAppleMetadata
+	backend.AppConfig.Rehash = config.rehash
+	backend.AppConfig.MaxFailures = config.maxFailures
+	backend.AppConfig.Filters = config.filters
 
 	// Handle album option - check for AUTO mode
 	if strings.ToUpper(config.albumName) == "AUTO" {
@@ -362,6 +476,18 @@ func runCLIUpload(filePaths []string, config cliConfig) error {
 		backend.AppConfig.AlbumAutoMode = false
 		backend.AppConfig.AlbumName = config.albumName
 	}
+	return nil
+}
+
+// CLI upload implementation. The returned exit code reflects the outcome of
+// the upload; the error is only set when the upload could not run at all.
+func runCLIUpload(filePaths []string, config cliConfig) (int, error) {
+	if err := applyCLIConfig(config); err != nil {
+		return 1, err
+	}
+	if config.dryRun {
+		return runCLIPlan(filePaths, config)
+	}
 
 	// Parse log level
 	logLevel := parseLogLevel(config.logLevel)
@@ -378,13 +504,25 @@ func runCLIUpload(filePaths []string, config cliConfig) error {
 	}
 	p := tea.NewProgram(model, programOptions...)
 
+	var ndjson *ndjsonWriter
+	if config.output == "ndjson" {
+		ndjson = newNDJSONWriter(os.Stdout)
+	}
+
 	// Create CLI app with event callback to bubbletea
 	eventCallback := func(event string, data any) {
+		if ndjson != nil {
+			ndjson.writeBackendEvent(event, data)
+		}
 		switch event {
 		case "uploadStart":
 			if start, ok := data.(backend.UploadBatchStart); ok {
 				p.Send(uploadStartMsg{total: start.Total})
 			}
+		case "uploadTotal":
+			if total, ok := data.(backend.UploadBatchTotal); ok {
+				p.Send(uploadTotalMsg{total: total.Total, scanning: total.Scanning})
+			}
 		case "ThreadStatus":
 			if status, ok := data.(backend.ThreadStatus); ok {
 				fileName := status.FileName
@@ -406,6 +544,7 @@ func runCLIUpload(filePaths []string, config cliConfig) error {
 					mediaKey:   result.MediaKey,
 					skipCode:   result.SkipCode,
 					skipReason: result.SkipReason,
+					account:    result.Account,
 					err:        result.Error,
 				})
 			}
@@ -453,31 +592,62 @@ func runCLIUpload(filePaths []string, config cliConfig) error {
 		uploadManager.Upload(cliApp, filePaths)
 	}()
 
-	// Run until the upload manager emits uploadStop.
+	// Run until the upload manager emits uploadStop. Without the TUI, SIGINT
+	// ends the program with ErrInterrupted instead of a ctrl+c key press.
 	finalModel, err := p.Run()
-	if err != nil {
-		return fmt.Errorf("error running upload program: %w", err)
+	interrupted := errors.Is(err, tea.ErrInterrupted)
+	if err != nil && !interrupted {
+		return 1, fmt.Errorf("error running upload program: %w", err)
 	}
 
-	// Print JSON summary after the upload program completes.
-	if m, ok := finalModel.(uploadModel); ok {
-		summary := buildUploadSummary(m)
+	m, ok := finalModel.(uploadModel)
+	if !ok {
+		return 1, fmt.Errorf("unexpected upload program state")
+	}
+	cancelled := interrupted || m.cancelled
+	if cancelled {
+		uploadManager.Cancel()
+	}
 
+	// Print JSON summary after the upload program completes.
+	summary := buildUploadSummary(m)
+	options := backend.CurrentUploadRunOptions()
+	summary.Options = &options
+	if ndjson != nil {
+		ndjson.write(ndjsonUploadSummary, summary)
+	} else {
 		jsonOutput, err := json.MarshalIndent(summary, "", "  ")
 		if err != nil {
-			return fmt.Errorf("error generating JSON: %w", err)
+			return 1, fmt.Errorf("error generating JSON: %w", err)
 		}
-
 		fmt.Println(string(jsonOutput))
 	}
 
-	return nil
+	return uploadExitCode(m, cancelled), nil
+}
+
+// uploadExitCode maps the outcome to an exit code. Cancellation wins over
+// failures, and any rejected credentials win over other failures because
+// retrying will not help until they are fixed.
+func uploadExitCode(model uploadModel, cancelled bool) int {
+	switch {
+	case cancelled:
+		return exitCancelled
+	case model.authFailed:
+		return exitAuthFailure
+	case model.failed == 0:
+		return 0
+	case model.completed == 0:
+		return exitTotalFailure
+	default:
+		return exitPartialFailure
+	}
 }
 
 func buildUploadSummary(model uploadModel) uploadSummary {
 	warnings := make([]uploadWarning, 0, len(model.warnings))
 	for _, warning := range model.warnings {
-		if warning.Code == "incomplete-live-photo-skipped" || warning.Code == "ambiguous-filename-stem" {
+		if backend.IsSkippedPreflightWarning(warning.Code) {
 			continue
 		}
 		warnings = append(warnings, warning)
@@ -490,6 +660,9 @@ func buildUploadSummary(model uploadModel) uploadSummary {
 		Results:   model.results,
 		Warnings:  warnings,
 	}
+	if len(backend.AppConfig.Routes) > 0 {
+		summary.Accounts = summarizeAccounts(model.results)
+	}
 	if model.albumName != "" {
 		summary.Album = &albumSummary{
 			Name:       model.albumName,
@@ -500,3 +673,33 @@ func buildUploadSummary(model uploadModel) uploadSummary {
 	}
 	return summary
 }
+
+// summarizeAccounts counts results by account, in the order each account
+// first appears. Results without an account, such as scan errors, are left
+// out.
+func summarizeAccounts(results []uploadResult) []accountSummary {
+	var accounts []accountSummary
+	indexes := make(map[string]int)
+	for _, result := range results {
+		if result.Account == "" {
+			continue
+		}
+		index, ok := indexes[result.Account]
+		if !ok {
+			index = len(accounts)
+			indexes[result.Account] = index
+			accounts = append(accounts, accountSummary{Account: result.Account})
+		}
+		account := &accounts[index]
+		account.Total++
+		switch {
+		case result.Skipped:
+			account.Skipped++
+		case result.Success:
+			account.Succeeded++
+		default:
+			account.Failed++
+		}
+	}
+	return accounts
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"app/backend"
+)
+
+// credentialProblemHints tell the user what to do about a failed test.
+var credentialProblemHints = map[string]string{
+	backend.CredentialProblemInvalid:        "the credential is not stored; add it with 'creds add'",
+	backend.CredentialProblemRevoked:        "the auth string was rejected, most likely revoked; extract a new one, then 'creds rm' and 'creds add' it",
+	backend.CredentialProblemBindingMissing: "the account requires token binding; add its token_binding_alias (the GUI can read it over ADB)",
+	backend.CredentialProblemBindingFailed:  "the token binding key could not be used; check the token_binding_alias",
+	backend.CredentialProblemNetwork:        "Google could not be reached; check the network connection",
+	backend.CredentialProblemProxy:          "the configured proxy could not be used; check the proxy setting",
+	backend.CredentialProblemPhotos:         "signing in worked but Google Photos refused the token",
+	backend.CredentialProblemUnknown:        "unexpected failure",
+}
+
+// runCredentialTest handles creds test [email] [--json] and exits non-zero
+// when the credential does not work.
+func runCredentialTest(args []string) {
+	asJSON := false
+	query := ""
+	for _, arg := range args {
+		switch {
+		case arg == "--json":
+			asJSON = true
+		case query == "" && arg != "" && arg[0] != '-':
+			query = arg
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown argument %q\n", arg)
+			fmt.Printf("Usage: %s creds test [email] [--json]\n", cliExecutableName)
+			os.Exit(1)
+		}
+	}
+
+	email := backend.AppConfig.Selected
+	if query != "" {
+		var err error
+		if email, err = backend.MatchAccount(query); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if email == "" {
+		fmt.Fprintln(os.Stderr, "Error: no account is selected; pass an email")
+		os.Exit(1)
+	}
+
+	result := backend.TestCredential(email)
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(result)
+	} else {
+		printCredentialTest(result)
+	}
+	if result.Problem != "" {
+		os.Exit(1)
+	}
+}
+
+func printCredentialTest(result backend.CredentialTestResult) {
+	status := func(ok bool, attempted bool) string {
+		switch {
+		case ok:
+			return "ok"
+		case attempted:
+			return "failed"
+		default:
+			return "not tried"
+		}
+	}
+	binding := "not required"
+	switch {
+	case result.TokenBindingNeeded && result.TokenBindingConfigured:
+		binding = "required, configured"
+	case result.TokenBindingNeeded:
+		binding = "required, not configured"
+	case result.TokenBindingConfigured:
+		binding = "configured"
+	}
+
+	fmt.Printf("Testing %s\n", result.Email)
+	auth := status(result.AuthOK, true)
+	if result.AuthOK {
+		auth += fmt.Sprintf(", token valid until %s", result.TokenExpiry.Format(time.DateTime))
+	}
+	fmt.Printf("  Sign-in:        %s\n", auth)
+	fmt.Printf("  Token binding:  %s\n", binding)
+	fmt.Printf("  Library lookup: %s\n", status(result.ProbeOK, result.AuthOK))
+	if result.Problem == "" {
+		fmt.Println("✓ Credential works")
+		return
+	}
+	fmt.Printf("✗ %s: %s\n", result.Problem, credentialProblemHints[result.Problem])
+	fmt.Printf("  %s\n", result.Error)
+}
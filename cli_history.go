@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/backend"
+)
+
+func printHistoryHelp() {
+	fmt.Printf("Usage: %s history <subcommand> [args] [flags]\n", cliExecutableName)
+	fmt.Println()
+	fmt.Println("Subcommands:")
+	fmt.Println("  list, ls                List recent upload results")
+	fmt.Println("  show <id|path>          Show one entry by ID, or every attempt for a local file")
+	fmt.Println("  search <query>          Search by path, SHA-1 prefix, media key, album key or account")
+	fmt.Println()
+	fmt.Println("Flags:")
+	fmt.Println("  -n, --limit <n>         Maximum number of entries (default: 50, 0 = all)")
+	fmt.Println("  --json                  Print entries as JSON")
+	fmt.Println("  -c, --config <path>     Path to config file")
+}
+
+type historyArgs struct {
+	positional []string
+	limit      int
+	json       bool
+	configPath string
+}
+
+func parseHistoryArgs(args []string) (historyArgs, error) {
+	parsed := historyArgs{limit: 50}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-n", "--limit":
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("%s requires a value", arg)
+			}
+			limit, err := strconv.Atoi(args[i+1])
+			if err != nil || limit < 0 {
+				return parsed, fmt.Errorf("invalid limit: %s", args[i+1])
+			}
+			parsed.limit = limit
+			i++
+		case "--json":
+			parsed.json = true
+		case "-c", "--config":
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("%s requires a value", arg)
+			}
+			parsed.configPath = args[i+1]
+			i++
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return parsed, fmt.Errorf("unknown flag: %s", arg)
+			}
+			parsed.positional = append(parsed.positional, arg)
+		}
+	}
+	return parsed, nil
+}
+
+func handleHistoryCommand(args []string) {
+	if len(args) == 0 || args[0] == "--help" || args[0] == "-h" {
+		printHistoryHelp()
+		if len(args) == 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	subcommand := args[0]
+	parsed, err := parseHistoryArgs(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if parsed.configPath != "" {
+		backend.ConfigPath = parsed.configPath
+	}
+	// Load config so the history store is resolved exactly as during upload.
+	if err := backend.LoadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	var entries []backend.UploadHistoryEntry
+	switch subcommand {
+	case "list", "ls":
+		entries, err = backend.ListUploadHistory(parsed.limit)
+
+	case "show":
+		if len(parsed.positional) < 1 {
+			fmt.Println("Error: id or path required")
+			fmt.Printf("Usage: %s history show <id|path>\n", cliExecutableName)
+			os.Exit(1)
+		}
+		target := parsed.positional[0]
+		if id, parseErr := strconv.ParseInt(target, 10, 64); parseErr == nil {
+			var entry backend.UploadHistoryEntry
+			entry, err = backend.GetUploadHistoryEntry(id)
+			entries = []backend.UploadHistoryEntry{entry}
+		} else {
+			entries, err = backend.UploadHistoryForPath(target)
+			if err == nil && len(entries) == 0 {
+				err = fmt.Errorf("no history for %s", target)
+			}
+		}
+		if err == nil && !parsed.json {
+			for i, entry := range entries {
+				if i > 0 {
+					fmt.Println()
+				}
+				printHistoryEntryDetails(entry)
+			}
+			return
+		}
+
+	case "search", "find":
+		if len(parsed.positional) < 1 {
+			fmt.Println("Error: search query required")
+			fmt.Printf("Usage: %s history search <query>\n", cliExecutableName)
+			os.Exit(1)
+		}
+		entries, err = backend.SearchUploadHistory(strings.Join(parsed.positional, " "), parsed.limit)
+
+	default:
+		fmt.Printf("Error: unknown subcommand '%s'\n\n", subcommand)
+		printHistoryHelp()
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if parsed.json {
+		if entries == nil {
+			entries = []backend.UploadHistoryEntry{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No history entries found")
+		return
+	}
+	for _, entry := range entries {
+		detail := entry.MediaKey
+		switch {
+		case entry.IsError:
+			detail = entry.Error
+		case entry.Skipped && entry.SkipCode != "":
+			detail = entry.SkipCode
+		}
+		fmt.Printf("%6d  %s  %-8s  %s  %s\n",
+			entry.ID,
+			entry.UploadedAt.Format(time.DateTime),
+			entry.Status(),
+			entry.Path,
+			detail,
+		)
+	}
+}
+
+func printHistoryEntryDetails(entry backend.UploadHistoryEntry) {
+	fmt.Printf("ID:          %d\n", entry.ID)
+	fmt.Printf("Status:      %s\n", entry.Status())
+	fmt.Printf("Time:        %s\n", entry.UploadedAt.Format(time.DateTime))
+	if entry.Account != "" {
+		fmt.Printf("Account:     %s\n", entry.Account)
+	}
+	fmt.Printf("Path:        %s\n", entry.Path)
+	for _, path := range entry.Paths {
+		if path != entry.Path {
+			fmt.Printf("             %s\n", path)
+		}
+	}
+	if entry.IsLivePhoto {
+		fmt.Println("Live Photo:  yes")
+	}
+	if entry.SHA1 != "" {
+		fmt.Printf("SHA-1:       %s\n", entry.SHA1)
+	}
+	if entry.MediaKey != "" {
+		fmt.Printf("Media key:   %s\n", entry.MediaKey)
+	}
+	if len(entry.AlbumKeys) > 0 {
+		fmt.Printf("Albums:      %s\n", strings.Join(entry.AlbumKeys, ", "))
+	}
+	if entry.SkipCode != "" {
+		fmt.Printf("Skip code:   %s\n", entry.SkipCode)
+	}
+	if entry.Error != "" {
+		fmt.Printf("Error:       %s\n", entry.Error)
+	}
+	fmt.Printf("Run:         %s\n", entry.RunID)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"app/backend"
+)
+
+// NDJSON output (--output ndjson) writes one JSON object per line:
+//
+//	{"event": "<name>.v<N>", "time": "<RFC 3339>", "data": {...}}
+//
+// Event names carry a version suffix. Fields are only ever added to a
+// version; renaming or removing one requires a new version. The payloads below
+// are the documented schema and are deliberately decoupled from the backend
+// structs so that internal changes cannot break scripts.
+const (
+	ndjsonUploadStart      = "upload.start.v2"
+	ndjsonUploadStop       = "upload.stop.v1"
+	ndjsonUploadWarning    = "upload.warning.v1"
+	ndjsonUploadTotal      = "upload.total.v1"
+	ndjsonUploadTotalBytes = "upload.total_bytes.v1"
+	ndjsonUploadBytesDelta = "upload.total_bytes_delta.v1"
+	ndjsonThreadStatus     = "thread.status.v1"
+	ndjsonFileStatus       = "file.status.v1"
+	ndjsonAlbumProgress    = "album.progress.v1"
+	ndjsonAlbumComplete    = "album.complete.v1"
+	ndjsonAlbumError       = "album.error.v1"
+	ndjsonUploadSummary    = "upload.summary.v1"
+	ndjsonPlanItem         = "plan.item.v1"
+	ndjsonPlanSummary      = "plan.summary.v1"
+)
+
+type ndjsonEvent struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Data  any       `json:"data,omitempty"`
+}
+
+type ndjsonUploadTotalData struct {
+	Total      int   `json:"total"`
+	TotalBytes int64 `json:"totalBytes"`
+	Scanning   bool  `json:"scanning"`
+}
+
+type ndjsonTotalBytesData struct {
+	Bytes int64 `json:"bytes"`
+}
+
+type ndjsonThreadStatusData struct {
+	WorkerID      int    `json:"workerId"`
+	Status        string `json:"status"`
+	Path          string `json:"path,omitempty"`
+	Message       string `json:"message,omitempty"`
+	BytesUploaded int64  `json:"bytesUploaded,omitempty"`
+	BytesTotal    int64  `json:"bytesTotal,omitempty"`
+	Attempt       int    `json:"attempt,omitempty"`
+}
+
+// ndjsonFileStatusData.Status is one of "uploaded", "skipped" or "failed".
+type ndjsonFileStatusData struct {
+	Path        string   `json:"path"`
+	Paths       []string `json:"paths,omitempty"`
+	Status      string   `json:"status"`
+	MediaKey    string   `json:"mediaKey,omitempty"`
+	IsLivePhoto bool     `json:"isLivePhoto,omitempty"`
+	SkipCode    string   `json:"skipCode,omitempty"`
+	SkipReason  string   `json:"skipReason,omitempty"`
+	Account     string   `json:"account,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+type ndjsonAlbumData struct {
+	AlbumName  string   `json:"albumName"`
+	ItemsAdded int      `json:"itemsAdded,omitempty"`
+	TotalItems int      `json:"totalItems,omitempty"`
+	AlbumKeys  []string `json:"albumKeys,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ndjsonWriter serializes events from concurrent upload workers.
+type ndjsonWriter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	return &ndjsonWriter{encoder: json.NewEncoder(w)}
+}
+
+func (w *ndjsonWriter) write(event string, data any) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.encoder.Encode(ndjsonEvent{Event: event, Time: time.Now().UTC(), Data: data})
+}
+
+// writeBackendEvent translates a backend event into its versioned NDJSON form.
+// Unknown events are ignored so new backend events never leak unversioned.
+func (w *ndjsonWriter) writeBackendEvent(event string, data any) {
+	switch event {
+	case "uploadStart":
+		// The scan runs alongside the upload, so the totals follow in
+		// upload.total events instead.
+		w.write(ndjsonUploadStart, nil)
+	case "uploadStop":
+		w.write(ndjsonUploadStop, nil)
+	case "uploadWarning":
+		if warning, ok := data.(backend.PreflightWarning); ok {
+			w.write(ndjsonUploadWarning, uploadWarning{Paths: warning.Paths, Code: warning.Code, Message: warning.Message})
+		}
+	case "uploadTotal":
+		if total, ok := data.(backend.UploadBatchTotal); ok {
+			w.write(ndjsonUploadTotal, ndjsonUploadTotalData{Total: total.Total, TotalBytes: total.TotalBytes, Scanning: total.Scanning})
+		}
+	case "uploadTotalBytes":
+		if bytes, ok := data.(int64); ok {
+			w.write(ndjsonUploadTotalBytes, ndjsonTotalBytesData{Bytes: bytes})
+		}
+	case "uploadTotalBytesDelta":
+		if bytes, ok := data.(int64); ok {
+			w.write(ndjsonUploadBytesDelta, ndjsonTotalBytesData{Bytes: bytes})
+		}
+	case "ThreadStatus":
+		if status, ok := data.(backend.ThreadStatus); ok {
+			w.write(ndjsonThreadStatus, ndjsonThreadStatusData{
+				WorkerID:      status.WorkerID,
+				Status:        status.Status,
+				Path:          status.FilePath,
+				Message:       status.Message,
+				BytesUploaded: status.BytesUploaded,
+				BytesTotal:    status.BytesTotal,
+				Attempt:       status.Attempt,
+			})
+		}
+	case "FileStatus":
+		if result, ok := data.(backend.FileUploadResult); ok {
+			fileStatus := ndjsonFileStatusData{
+				Path:        result.Path,
+				Paths:       result.Paths,
+				Status:      "uploaded",
+				MediaKey:    result.MediaKey,
+				IsLivePhoto: result.IsLivePhoto,
+				SkipCode:    result.SkipCode,
+				SkipReason:  result.SkipReason,
+				Account:     result.Account,
+			}
+			switch {
+			case result.IsError:
+				fileStatus.Status = "failed"
+				fileStatus.Error = result.ErrorMessage
+				if fileStatus.Error == "" && result.Error != nil {
+					fileStatus.Error = result.Error.Error()
+				}
+			case result.Skipped:
+				fileStatus.Status = "skipped"
+			}
+			w.write(ndjsonFileStatus, fileStatus)
+		}
+	case "albumProgress", "albumComplete":
+		if status, ok := data.(backend.AlbumStatus); ok {
+			name := ndjsonAlbumProgress
+			if event == "albumComplete" {
+				name = ndjsonAlbumComplete
+			}
+			w.write(name, ndjsonAlbumData{
+				AlbumName:  status.AlbumName,
+				ItemsAdded: status.ItemsAdded,
+				TotalItems: status.TotalItems,
+				AlbumKeys:  status.AlbumKeys,
+			})
+		}
+	case "albumError":
+		if albumErr, ok := data.(backend.AlbumError); ok {
+			w.write(ndjsonAlbumError, ndjsonAlbumData{AlbumName: albumErr.AlbumName, Error: albumErr.Error})
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"app/backend"
+)
+
+type uploadPlanOutput struct {
+	backend.UploadPlan
+	Counts map[string]int `json:"counts"`
+}
+
+// runCLIPlan implements --dry-run. It prints what the upload would do without
+// requesting upload tokens, committing media or deleting anything.
+func runCLIPlan(filePaths []string, config cliConfig) (int, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	plan, err := backend.PlanUpload(ctx, filePaths)
+	if errors.Is(err, context.Canceled) {
+		return exitCancelled, nil
+	}
+	if errors.Is(err, backend.ErrAuthFailed) {
+		return exitAuthFailure, err
+	}
+	if err != nil {
+		return 1, err
+	}
+
+	counts := make(map[string]int)
+	for _, item := range plan.Items {
+		counts[item.Action]++
+	}
+
+	if config.output == "ndjson" {
+		writer := newNDJSONWriter(os.Stdout)
+		for _, warning := range plan.Warnings {
+			writer.write(ndjsonUploadWarning, uploadWarning{Paths: warning.Paths, Code: warning.Code, Message: warning.Message})
+		}
+		for _, item := range plan.Items {
+			writer.write(ndjsonPlanItem, item)
+		}
+		writer.write(ndjsonPlanSummary, counts)
+		return 0, nil
+	}
+
+	jsonOutput, err := json.MarshalIndent(uploadPlanOutput{UploadPlan: plan, Counts: counts}, "", "  ")
+	if err != nil {
+		return 1, fmt.Errorf("error generating JSON: %w", err)
+	}
+	fmt.Println(string(jsonOutput))
+	return 0, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"app/backend"
+)
+
+// retryHistorySource makes --retry-failed read the most recent run from the
+// local history store instead of a summary file.
+const retryHistorySource = "history"
+
+// retryGroup is one failed item: the paths that go up together and the
+// account they were uploaded to, if the run recorded it.
+type retryGroup struct {
+	paths   []string
+	account string
+}
+
+// resolveRetryFailed replaces the upload paths with the failed items of a
+// previous run and restores that run's account, album and Live Photo settings
+// unless they were given explicitly on the command line. With --account only
+// the items of that account are retried, and a run that failed on several
+// accounts has to be retried one account at a time.
+func resolveRetryFailed(config cliConfig) ([]string, cliConfig, error) {
+	if config.configPath != "" {
+		backend.ConfigPath = config.configPath
+	}
+	if err := backend.LoadConfig(); err != nil {
+		return nil, cliConfig{}, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	groups, options, err := loadRetryGroups(config.retryFailed)
+	if err != nil {
+		return nil, cliConfig{}, err
+	}
+
+	seen := make(map[string]bool)
+	paths := make([]string, 0, len(groups))
+	accounts := make(map[string]bool)
+	queued := 0
+	needsPairing := false
+	for _, group := range groups {
+		if config.account != "" && group.account != "" && !retryAccountMatches(group.account, config.account) {
+			continue
+		}
+		available := 0
+		for _, path := range group.paths {
+			if seen[path] {
+				continue
+			}
+			if _, err := os.Stat(path); err != nil {
+				fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", path, err)
+				continue
+			}
+			seen[path] = true
+			paths = append(paths, path)
+			available++
+		}
+		if available == 0 {
+			continue
+		}
+		queued++
+		if group.account != "" {
+			accounts[group.account] = true
+		}
+		if available > 1 {
+			needsPairing = true
+		}
+	}
+	if len(paths) == 0 {
+		return nil, cliConfig{}, fmt.Errorf("no failed uploads to retry in %s", config.retryFailed)
+	}
+	if config.account == "" {
+		emails := make([]string, 0, len(accounts))
+		for email := range accounts {
+			emails = append(emails, email)
+		}
+		sort.Strings(emails)
+		switch len(emails) {
+		case 0:
+		case 1:
+			config.account = emails[0]
+		default:
+			return nil, cliConfig{}, fmt.Errorf("the failed uploads in %s belong to several accounts (%s); retry them one account at a time with --account",
+				config.retryFailed, strings.Join(emails, ", "))
+		}
+	}
+
+	if options == nil {
+		options = &backend.UploadRunOptions{}
+	}
+	if config.albumName == "" {
+		if options.AlbumAutoMode {
+			config.albumName = "AUTO"
+		} else {
+			config.albumName = options.AlbumName
+		}
+	}
+	if !config.pairLivePhotos && (options.PairLivePhotos || needsPairing) {
+		config.pairLivePhotos = true
+		config.updateExistingPhotosToLive = options.UpdateExistingPhotosToLive
+		config.ignoreAppleMetadata = options.IgnoreAppleMetadata
+		if !config.skipIncompleteLivePhotosSet {
+			// Summaries written before options were recorded only carry pairs
+			// in Paths; fall back to the --pair-live-photos default for them.
+			config.skipIncompleteLivePhotos = options.SkipIncompleteLivePhotos || !options.PairLivePhotos
+			config.skipIncompleteLivePhotosSet = true
+		}
+	}
+	if options.DisableUnsupportedFilesFilter {
+		config.disableUnsupportedFilesFilter = true
+	}
+
+	fmt.Fprintf(os.Stderr, "Retrying %d failed item(s) from %s\n", queued, config.retryFailed)
+	return paths, config, nil
+}
+
+// retryAccountMatches reports whether query, as given to --account, selects
+// email. It matches like backend.MatchAccount, which cannot be used before the
+// credentials are unlocked.
+func retryAccountMatches(email string, query string) bool {
+	return email == query || strings.Contains(strings.ToLower(email), strings.ToLower(query))
+}
+
+// loadRetryGroups returns every failed item, one group per item so Live Photo
+// components stay together. When --max-failures left files out, each argument
+// of that run becomes a group of its own.
+func loadRetryGroups(source string) ([]retryGroup, *backend.UploadRunOptions, error) {
+	if strings.EqualFold(source, retryHistorySource) {
+		if _, err := os.Stat(source); err != nil {
+			options, entries, err := backend.LatestFailedUploads()
+			if err != nil {
+				return nil, nil, err
+			}
+			groups := make([]retryGroup, 0, len(entries))
+			for _, entry := range entries {
+				paths := entry.Paths
+				if len(paths) == 0 {
+					paths = []string{entry.Path}
+				}
+				groups = appendRetryGroup(groups, entry.SkipCode, entry.Account, paths)
+			}
+			return groups, &options, nil
+		}
+	}
+
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read summary: %w", err)
+	}
+	var summary uploadSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse summary %s: %w", source, err)
+	}
+	groups := make([]retryGroup, 0, summary.Failed)
+	for _, result := range summary.Results {
+		if result.Success || (result.Skipped && result.SkipCode != backend.SkipCodeMaxFailures) {
+			continue
+		}
+		paths := result.Paths
+		if len(paths) == 0 {
+			if result.Path == "" {
+				continue
+			}
+			paths = []string{result.Path}
+		}
+		groups = appendRetryGroup(groups, result.SkipCode, result.Account, paths)
+	}
+	return groups, summary.Options, nil
+}
+
+// appendRetryGroup adds the paths of one result to groups. The arguments left
+// out by --max-failures carry no account of their own: the retry routes them
+// again like the original run did.
+func appendRetryGroup(groups []retryGroup, skipCode string, account string, paths []string) []retryGroup {
+	if skipCode != backend.SkipCodeMaxFailures {
+		return append(groups, retryGroup{paths: paths, account: account})
+	}
+	for _, path := range paths {
+		groups = append(groups, retryGroup{paths: []string{path}})
+	}
+	return groups
+}
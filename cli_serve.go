@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"app/backend"
+)
+
+const defaultServeListenAddress = "127.0.0.1:8765"
+
+// serveTokenEnv sets the API token when --token is not given.
+const serveTokenEnv = "GOTOHP_SERVE_TOKEN"
+
+type serveOptions struct {
+	listen string
+	// token must be sent as a bearer token with every request, if not empty.
+	token string
+}
+
+func printServeHelp() {
+	fmt.Printf("Usage: %s serve [--listen <addr>] [--token <token>] [flags]\n", cliExecutableName)
+	fmt.Println()
+	fmt.Println("Runs a headless daemon with a local HTTP API. Jobs run one at a time.")
+	fmt.Println("Upload flags such as --threads or --album set the defaults for every job.")
+	fmt.Println("\nFlags:")
+	fmt.Printf("  --listen <addr>              Address to listen on (default: %s)\n", defaultServeListenAddress)
+	fmt.Println("  --token <token>              Require \"Authorization: Bearer <token>\" on every request")
+	fmt.Printf("                               (default: $%s). Required unless listening on loopback\n", serveTokenEnv)
+	fmt.Println("\nEndpoints:")
+	fmt.Println("  POST   /api/jobs             Enqueue {\"paths\": [...], \"album\": \"...\"} as application/json")
+	fmt.Println("  GET    /api/jobs             List jobs")
+	fmt.Println("  GET    /api/jobs/{id}        Show a job and its results")
+	fmt.Println("  DELETE /api/jobs/{id}        Cancel a queued or running job")
+	fmt.Println("  GET    /api/events           Stream events as Server-Sent Events")
+}
+
+func parseServeArgs(args []string) (serveOptions, cliConfig, error) {
+	options := serveOptions{listen: defaultServeListenAddress, token: os.Getenv(serveTokenEnv)}
+	uploadArgs := make([]string, 0, len(args))
+	for index := 0; index < len(args); index++ {
+		switch args[index] {
+		case "--listen", "--token":
+			if index+1 >= len(args) {
+				return serveOptions{}, cliConfig{}, fmt.Errorf("flag %s requires a value", args[index])
+			}
+			if args[index] == "--listen" {
+				options.listen = args[index+1]
+			} else {
+				options.token = args[index+1]
+			}
+			index++
+		case "--retry-failed", "--no-tui", "--output", "-o":
+			return serveOptions{}, cliConfig{}, fmt.Errorf("%s is not supported by serve", args[index])
+		default:
+			uploadArgs = append(uploadArgs, args[index])
+		}
+	}
+
+	positional, config, err := parseUploadFlags(uploadArgs)
+	if err != nil {
+		return serveOptions{}, cliConfig{}, err
+	}
+	if len(positional) > 0 {
+		return serveOptions{}, cliConfig{}, fmt.Errorf("unexpected argument %q; submit paths through the API", positional[0])
+	}
+	host, _, err := net.SplitHostPort(options.listen)
+	if err != nil {
+		return serveOptions{}, cliConfig{}, fmt.Errorf("invalid listen address %q: %w", options.listen, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) && options.token == "" {
+		return serveOptions{}, cliConfig{}, fmt.Errorf("%s is reachable from other machines; set a token with --token or %s", options.listen, serveTokenEnv)
+	}
+	return options, config, nil
+}
+
+func runCLIServe(options serveOptions, config cliConfig) error {
+	if err := applyCLIConfig(config); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	daemonApp := backend.NewDaemonApp(parseLogLevel(config.logLevel))
+	daemon := backend.NewDaemon(daemonApp, options.token)
+	fmt.Fprintf(os.Stderr, "Serving on http://%s (Ctrl+C to stop)\n", options.listen)
+	return daemon.Serve(ctx, options.listen)
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 	"slices"
-	"strings"
 
 	"app/backend"
 )
@@ -21,7 +20,11 @@ func getAppVersion() string {
 func isCLICommand(arg string) bool {
 	supportedCommands := []string{
 		"upload",
+		"watch",
+		"serve",
 		"credentials", "creds", // Support both full and short form
+		"history",
+		"trash",
 		"help", "--help", "-h",
 		"version", "--version", "-v",
 	}
@@ -45,7 +48,14 @@ func runCLI() {
 			fmt.Printf("Usage: %s upload <path> [<path> ...] [flags]\n", cliExecutableName)
 			fmt.Println("\nFlags:")
 			fmt.Println("  -r, --recursive              Include subdirectories")
+			fmt.Println("  --max-depth <n>              With -r, descend at most n levels below each directory")
+			fmt.Println("  --follow-symlinks            Descend into symlinked directories; each is scanned once")
+			fmt.Println("  --scan-threads <n>           Directories read in parallel while scanning (default: 4)")
 			fmt.Println("  -t, --threads <n>            Number of upload threads (default: 3)")
+			fmt.Println("  --hash-threads <n>           Files hashed and checked ahead of the uploads (default: 2)")
+			fmt.Println("  --adaptive-threads           Vary active upload threads by throughput, up to --threads")
+			fmt.Println("  --hash-while-upload          Read new files once, hashing them during the upload")
+			fmt.Println("  --limit-rate <rate>          Cap total upload bandwidth, e.g. 2M or 08:00-19:00=2M,off")
 			fmt.Println("  -f, --force                  Force upload even if file exists")
 			fmt.Println("  --pair-live-photos           Pair Apple Live Photo files; incomplete pairs are skipped")
 			fmt.Println("  --skip-incomplete-live-photos  Skip incomplete Live Photo members")
@@ -53,14 +63,45 @@ func runCLI() {
 			fmt.Println("  --update-existing-photos-to-live  Attach matching MOV files to existing photos")
 			fmt.Println("  --ignore-apple-metadata      Match Live Photo pairs by filename stem instead of Apple metadata")
 			fmt.Println("  -d, --delete                 Delete from host after upload")
+			fmt.Println("  --verify-delete              Re-check the library by hash before deleting local files")
+			fmt.Println("  --trash-dir <dir>            Move files to <dir> instead of deleting them")
+			fmt.Println("                               Restore them with 'trash restore'")
 			fmt.Println("  -df, --disable-filter        Disable file type filtering")
 			fmt.Println("  --date-from-filename         Set media date from filename (e.g. 20240709_182027.jpg)")
-			fmt.Println("  -e, --exclude <pattern>      Exclude directories whose name matches pattern (e.g. @eaDir)")
+			fmt.Println("  --rehash                     Ignore the local hash cache and re-read every file")
+			fmt.Println("  -e, --exclude <pattern>      Skip files and directories matching a gitignore-style pattern")
+			fmt.Println("                               (e.g. @eaDir, Thumbs/, '*.tmp', '._*'); repeatable")
+			fmt.Println("  -i, --include <pattern>      Only upload files matching a pattern (e.g. '*.jpg'); repeatable")
+			fmt.Println("                               .gotohpignore files in scanned directories are always honored")
+			fmt.Println("  --min-size <size>            Skip files smaller than size (e.g. 100K)")
+			fmt.Println("  --max-size <size>            Skip files of size or larger (e.g. 4G)")
+			fmt.Println("  --modified-after <date>      Skip files modified before date (YYYY-MM-DD[ HH:MM:SS])")
+			fmt.Println("  --modified-before <date>     Skip files modified on or after date")
+			fmt.Println("  --filename-date-after <date>   Skip files whose file name date is earlier")
+			fmt.Println("  --filename-date-before <date>  Skip files whose file name date is this or later")
+			fmt.Println("  --media <classes>            Only upload these media classes: photo, video, raw (e.g. video,raw)")
 			fmt.Println("  -a, --album <name>           Add uploaded files to album (creates if needed)")
 			fmt.Println("                               Use 'AUTO' to create albums based on folder names")
+			fmt.Println("  --retry-failed <source>      Re-upload only the failures from a JSON summary file,")
+			fmt.Println("                               or from the last run when <source> is 'history'")
 			fmt.Println("  -l, --log-level <level>      Set log level: debug, info, warn, error (default: info)")
 			fmt.Println("  -c, --config <path>          Path to config file")
+			fmt.Println("  --account <email>            Use this account instead of the selected one")
+			fmt.Println("                               (supports partial matching)")
+			fmt.Println("  -o, --output <format>        Output format: json (summary at the end, default) or")
+			fmt.Println("                               ndjson (one versioned event per line as it happens)")
 			fmt.Println("  --no-tui                     Disable the interactive progress UI")
+			fmt.Println("  --dry-run                    Hash and check files, then print what would be uploaded,")
+			fmt.Println("                               skipped or paired, without uploading or deleting anything")
+			fmt.Println("  --fail-fast                  Stop starting new uploads after the first failure")
+			fmt.Println("  --max-failures <n>           Stop starting new uploads after n failures")
+			fmt.Println("\nExit codes:")
+			fmt.Println("  0    All files uploaded or skipped")
+			fmt.Println("  1    Invalid arguments or setup error")
+			fmt.Println("  2    Some files failed")
+			fmt.Println("  3    Every attempted file failed")
+			fmt.Println("  4    Authentication failed")
+			fmt.Println("  130  Cancelled")
 			return
 		}
 
@@ -72,15 +113,54 @@ func runCLI() {
 		}
 
 		filePaths, config, err := parseUploadArgs(os.Args[2:])
+		if err == nil && config.retryFailed != "" {
+			filePaths, config, err = resolveRetryFailed(config)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
 		// Run upload
-		err = runCLIUpload(filePaths, config)
+		exitCode, err := runCLIUpload(filePaths, config)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Upload failed: %v\n", err)
+		}
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+
+	case "watch":
+		if len(os.Args) > 2 && (os.Args[2] == "--help" || os.Args[2] == "-h") {
+			printWatchHelp()
+			return
+		}
+
+		dirs, config, options, err := parseWatchArgs(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Printf("\nRun '%s watch --help' for more information\n", cliExecutableName)
+			os.Exit(1)
+		}
+		if err := runCLIWatch(dirs, config, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Watch failed: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "serve":
+		if len(os.Args) > 2 && (os.Args[2] == "--help" || os.Args[2] == "-h") {
+			printServeHelp()
+			return
+		}
+
+		options, config, err := parseServeArgs(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Printf("\nRun '%s serve --help' for more information\n", cliExecutableName)
+			os.Exit(1)
+		}
+		if err := runCLIServe(options, config); err != nil {
+			fmt.Fprintf(os.Stderr, "Serve failed: %v\n", err)
 			os.Exit(1)
 		}
 
@@ -108,6 +188,12 @@ func runCLI() {
 		}
 		handleCredentialsCommand(args)
 
+	case "history":
+		handleHistoryCommand(os.Args[2:])
+
+	case "trash":
+		handleTrashCommand(os.Args[2:])
+
 	case "help", "--help", "-h":
 		printCLIHelp()
 	case "version", "--version", "-v":
@@ -119,13 +205,6 @@ func runCLI() {
 	}
 }
 
-func containsSubstring(str, substr string) bool {
-	// Case-insensitive substring search
-	strLower := strings.ToLower(str)
-	substrLower := strings.ToLower(substr)
-	return strings.Contains(strLower, substrLower)
-}
-
 func printCLIHelp() {
 	fmt.Println("gotohp - Google Photos unofficial client")
 	fmt.Println()
@@ -137,7 +216,11 @@ func printCLIHelp() {
 	fmt.Println()
 	fmt.Println("Commands:")
 	fmt.Println("  upload <path> [<path> ...]   Upload files or directories")
+	fmt.Println("  watch <dir> [<dir> ...]      Upload new files as they appear")
+	fmt.Println("  serve               Run a headless daemon with a local HTTP API")
 	fmt.Println("  creds               Manage Google Photos credentials")
+	fmt.Println("  history             Show locally recorded upload results")
+	fmt.Println("  trash               List or restore files moved by --trash-dir")
 	fmt.Println("  help                Show this help message")
 	fmt.Println("  version             Show version information")
 	fmt.Println()
@@ -152,6 +235,13 @@ func printCredentialsHelp() {
 	fmt.Println("  remove, rm <email>      Remove a credential by email")
 	fmt.Println("  list, ls                List all credentials")
 	fmt.Println("  set, select <email>     Set active credential (supports partial matching)")
+	fmt.Println("  test [email] [--json]   Sign in and look up the library to check a credential")
+	fmt.Println("  lock                    Encrypt credentials with a passphrase")
+	fmt.Println("    --key-file <path>     Use a key file instead, created if missing")
+	fmt.Println("  rekey                   Encrypt credentials with a new passphrase or --key-file")
+	fmt.Println("  unlock                  Store credentials in plain text again")
+	fmt.Println()
+	fmt.Printf("Encrypted credentials are opened with their key file, %s, or a prompt.\n", backend.PassphraseEnv)
 }
 
 func handleCredentialsCommand(args []string) {
@@ -171,6 +261,22 @@ func handleCredentialsCommand(args []string) {
 	subcommand := args[0]
 
 	switch subcommand {
+	case "lock", "unlock", "rekey":
+		if err := handleVaultCommand(subcommand, args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := unlockCredentials(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch subcommand {
+	case "test":
+		runCredentialTest(args[1:])
+
 	case "add":
 		if len(args) < 2 {
 			fmt.Println("Error: auth-string required")
@@ -205,7 +311,11 @@ func handleCredentialsCommand(args []string) {
 			fmt.Println("No credentials found")
 			return
 		}
-		fmt.Println("Credentials:")
+		if backend.CredentialsEncrypted() {
+			fmt.Println("Credentials (encrypted):")
+		} else {
+			fmt.Println("Credentials:")
+		}
 		for i, cred := range config.Credentials {
 			params, err := backend.ParseAuthString(cred)
 			if err != nil {
@@ -230,51 +340,10 @@ func handleCredentialsCommand(args []string) {
 			fmt.Printf("Usage: %s creds set <email>\n", cliExecutableName)
 			os.Exit(1)
 		}
-		query := args[1]
-		config := configManager.GetConfig()
-
-		// Try to find exact match first
-		var matchedEmail string
-		for _, cred := range config.Credentials {
-			params, err := backend.ParseAuthString(cred)
-			if err != nil {
-				continue
-			}
-			email := params.Get("Email")
-			if email == query {
-				matchedEmail = email
-				break
-			}
-		}
-
-		// If no exact match, try fuzzy matching (substring match)
-		if matchedEmail == "" {
-			var candidates []string
-			for _, cred := range config.Credentials {
-				params, err := backend.ParseAuthString(cred)
-				if err != nil {
-					continue
-				}
-				email := params.Get("Email")
-				// Check if query is a substring of the email
-				if containsSubstring(email, query) {
-					candidates = append(candidates, email)
-				}
-			}
-
-			if len(candidates) == 0 {
-				fmt.Fprintf(os.Stderr, "Error: no credentials found matching '%s'\n", query)
-				os.Exit(1)
-			} else if len(candidates) == 1 {
-				matchedEmail = candidates[0]
-			} else {
-				fmt.Fprintf(os.Stderr, "Error: multiple credentials match '%s':\n", query)
-				for _, email := range candidates {
-					fmt.Fprintf(os.Stderr, "  - %s\n", email)
-				}
-				fmt.Fprintf(os.Stderr, "Please be more specific\n")
-				os.Exit(1)
-			}
+		matchedEmail, err := backend.MatchAccount(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
 
 		configManager.SetSelected(matchedEmail)
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"app/backend"
+)
+
+func printTrashHelp() {
+	fmt.Printf("Usage: %s trash <subcommand> [args] [flags]\n", cliExecutableName)
+	fmt.Println()
+	fmt.Println("Subcommands:")
+	fmt.Println("  list, ls                List files moved to the trash directory after upload")
+	fmt.Println("  restore <path> [...]    Move files back to their original location. A directory")
+	fmt.Println("                          restores everything that was trashed from below it")
+	fmt.Println()
+	fmt.Println("Flags:")
+	fmt.Println("  --dir <dir>             Trash directory (default: trash_dir from the config file)")
+	fmt.Println("  --all                   Restore every file in the trash")
+	fmt.Println("  --json                  Print entries as JSON")
+	fmt.Println("  -c, --config <path>     Path to config file")
+}
+
+type trashArgs struct {
+	positional []string
+	dir        string
+	all        bool
+	json       bool
+	configPath string
+}
+
+func parseTrashArgs(args []string) (trashArgs, error) {
+	var parsed trashArgs
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "--dir":
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("%s requires a value", arg)
+			}
+			parsed.dir = args[i+1]
+			i++
+		case "-c", "--config":
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("%s requires a value", arg)
+			}
+			parsed.configPath = args[i+1]
+			i++
+		case "--all":
+			parsed.all = true
+		case "--json":
+			parsed.json = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return parsed, fmt.Errorf("unknown flag: %s", arg)
+			}
+			parsed.positional = append(parsed.positional, arg)
+		}
+	}
+	return parsed, nil
+}
+
+func handleTrashCommand(args []string) {
+	if len(args) == 0 || args[0] == "--help" || args[0] == "-h" {
+		printTrashHelp()
+		if len(args) == 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	subcommand := args[0]
+	parsed, err := parseTrashArgs(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if parsed.dir == "" {
+		if parsed.configPath != "" {
+			backend.ConfigPath = parsed.configPath
+		}
+		if err := backend.LoadConfig(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+		parsed.dir = backend.AppConfig.TrashDir
+	}
+	if parsed.dir == "" {
+		fmt.Fprintln(os.Stderr, "Error: no trash directory; pass --dir or set trash_dir in the config file")
+		os.Exit(1)
+	}
+
+	switch subcommand {
+	case "list", "ls":
+		entries, err := backend.ListTrash(parsed.dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if parsed.json {
+			if entries == nil {
+				entries = []backend.TrashEntry{}
+			}
+			printTrashJSON(entries)
+			return
+		}
+		if len(entries) == 0 {
+			fmt.Println("Trash is empty")
+			return
+		}
+		for _, entry := range entries {
+			fmt.Printf("%s  %s  %s\n", entry.TrashedAt.Format(time.DateTime), entry.OriginalPath, entry.MediaKey)
+		}
+
+	case "restore":
+		if !parsed.all && len(parsed.positional) == 0 {
+			fmt.Println("Error: path or --all required")
+			fmt.Printf("Usage: %s trash restore <path> [...] | --all\n", cliExecutableName)
+			os.Exit(1)
+		}
+		targets := make([]string, 0, len(parsed.positional))
+		for _, target := range parsed.positional {
+			absolute, err := filepath.Abs(target)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			targets = append(targets, absolute)
+		}
+		results, err := backend.RestoreFromTrash(parsed.dir, func(entry backend.TrashEntry) bool {
+			return parsed.all || matchesTrashTarget(entry.OriginalPath, targets)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if len(results) == 0 {
+				os.Exit(1)
+			}
+		}
+		if parsed.json {
+			if results == nil {
+				results = []backend.TrashRestoreResult{}
+			}
+			printTrashJSON(results)
+		} else if len(results) == 0 {
+			fmt.Println("No matching files in the trash")
+		}
+		failed := 0
+		for _, result := range results {
+			if result.Error != "" {
+				failed++
+			}
+			if parsed.json {
+				continue
+			}
+			if result.Error != "" {
+				fmt.Printf("✗ %s: %s\n", result.OriginalPath, result.Error)
+			} else {
+				fmt.Printf("✓ %s\n", result.OriginalPath)
+			}
+		}
+		if failed > 0 || err != nil {
+			os.Exit(1)
+		}
+
+	default:
+		fmt.Printf("Error: unknown subcommand '%s'\n\n", subcommand)
+		printTrashHelp()
+		os.Exit(1)
+	}
+}
+
+// matchesTrashTarget reports whether path is one of targets or lies below one.
+func matchesTrashTarget(path string, targets []string) bool {
+	for _, target := range targets {
+		if path == target || strings.HasPrefix(path, strings.TrimSuffix(target, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func printTrashJSON(value any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
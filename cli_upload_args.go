@@ -4,9 +4,36 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
+
+	"app/backend"
 )
 
 func parseUploadArgs(args []string) ([]string, cliConfig, error) {
+	paths, config, err := parseUploadFlags(args)
+	if err != nil {
+		return nil, cliConfig{}, err
+	}
+	if config.retryFailed != "" {
+		if len(paths) > 0 {
+			return nil, cliConfig{}, fmt.Errorf("--retry-failed cannot be combined with upload paths")
+		}
+		return paths, config, nil
+	}
+	if len(paths) == 0 {
+		return nil, cliConfig{}, fmt.Errorf("at least one file or directory path is required")
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return nil, cliConfig{}, fmt.Errorf("invalid upload path %q: %w", path, err)
+		}
+	}
+	return paths, config, nil
+}
+
+// parseUploadFlags parses the upload flags and returns the remaining
+// positional arguments without validating them.
+func parseUploadFlags(args []string) ([]string, cliConfig, error) {
 	config := cliConfig{
 		threads:  3,
 		logLevel: "info",
@@ -26,10 +53,40 @@ func parseUploadArgs(args []string) ([]string, cliConfig, error) {
 		switch argument {
 		case "--recursive", "-r":
 			config.recursive = true
+		case "--follow-symlinks":
+			config.followSymlinks = true
+		case "--hash-while-upload":
+			config.hashWhileUpload = true
+		case "--adaptive-threads":
+			config.adaptiveThreads = true
+		case "--max-depth":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			if _, err := fmt.Sscanf(value, "%d", &config.maxDepth); err != nil || config.maxDepth < 1 {
+				return nil, cliConfig{}, fmt.Errorf("max-depth must be a positive integer, got %q", value)
+			}
+		case "--scan-threads":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			if _, err := fmt.Sscanf(value, "%d", &config.scanThreads); err != nil || config.scanThreads < 1 {
+				return nil, cliConfig{}, fmt.Errorf("scan-threads must be a positive integer, got %q", value)
+			}
 		case "--force", "-f":
 			config.forceUpload = true
 		case "--delete", "-d":
 			config.deleteFromHost = true
+		case "--verify-delete":
+			config.verifyBeforeDelete = true
+		case "--trash-dir":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			config.trashDir = value
 		case "--disable-filter", "-df":
 			config.disableUnsupportedFilesFilter = true
 		case "--date-from-filename":
@@ -52,12 +109,26 @@ func parseUploadArgs(args []string) ([]string, cliConfig, error) {
 			config.updateExistingPhotosToLive = true
 		case "--ignore-apple-metadata":
 			config.ignoreAppleMetadata = true
+		case "--rehash":
+			config.rehash = true
 		case "--exclude", "-e":
 			value, err := nextValue()
 			if err != nil {
 				return nil, cliConfig{}, err
 			}
-			config.excludePattern = value
+			if err := backend.ValidateScanPatterns([]string{value}); err != nil {
+				return nil, cliConfig{}, err
+			}
+			config.excludePatterns = append(config.excludePatterns, value)
+		case "--include", "-i":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			if err := backend.ValidateScanPatterns([]string{value}); err != nil {
+				return nil, cliConfig{}, err
+			}
+			config.includePatterns = append(config.includePatterns, value)
 		case "--threads", "-t":
 			value, err := nextValue()
 			if err != nil {
@@ -66,6 +137,23 @@ func parseUploadArgs(args []string) ([]string, cliConfig, error) {
 			if _, err := fmt.Sscanf(value, "%d", &config.threads); err != nil || config.threads < 1 {
 				return nil, cliConfig{}, fmt.Errorf("threads must be a positive integer, got %q", value)
 			}
+		case "--hash-threads":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			if _, err := fmt.Sscanf(value, "%d", &config.hashThreads); err != nil || config.hashThreads < 1 {
+				return nil, cliConfig{}, fmt.Errorf("hash-threads must be a positive integer, got %q", value)
+			}
+		case "--limit-rate":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			if _, err := backend.ParseRateSchedule(value); err != nil {
+				return nil, cliConfig{}, fmt.Errorf("--limit-rate: %w", err)
+			}
+			config.limitRate = value
 		case "--log-level", "-l":
 			value, err := nextValue()
 			if err != nil {
@@ -78,12 +166,93 @@ func parseUploadArgs(args []string) ([]string, cliConfig, error) {
 				return nil, cliConfig{}, err
 			}
 			config.configPath = value
+		case "--account":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			config.account = value
 		case "--album", "-a":
 			value, err := nextValue()
 			if err != nil {
 				return nil, cliConfig{}, err
 			}
 			config.albumName = value
+		case "--min-size", "--max-size":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			size, err := backend.ParseByteSize(value)
+			if err != nil {
+				return nil, cliConfig{}, fmt.Errorf("%s: %w", argument, err)
+			}
+			if argument == "--min-size" {
+				config.filters.MinSize = size
+			} else {
+				config.filters.MaxSize = size
+			}
+		case "--modified-after", "--modified-before", "--filename-date-after", "--filename-date-before":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			date, err := parseFilterDate(value)
+			if err != nil {
+				return nil, cliConfig{}, fmt.Errorf("%s: %w", argument, err)
+			}
+			switch argument {
+			case "--modified-after":
+				config.filters.ModifiedAfter = date
+			case "--modified-before":
+				config.filters.ModifiedBefore = date
+			case "--filename-date-after":
+				config.filters.FilenameDateAfter = date
+			default:
+				config.filters.FilenameDateBefore = date
+			}
+		case "--media":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			for _, class := range strings.Split(strings.ToLower(value), ",") {
+				class = strings.TrimSpace(class)
+				switch class {
+				case backend.MediaClassPhoto, backend.MediaClassVideo, backend.MediaClassRaw:
+					config.filters.MediaClasses = append(config.filters.MediaClasses, class)
+				default:
+					return nil, cliConfig{}, fmt.Errorf("media must be a list of photo, video and raw, got %q", value)
+				}
+			}
+		case "--dry-run":
+			config.dryRun = true
+		case "--fail-fast":
+			config.maxFailures = 1
+		case "--max-failures":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			if _, err := fmt.Sscanf(value, "%d", &config.maxFailures); err != nil || config.maxFailures < 1 {
+				return nil, cliConfig{}, fmt.Errorf("max-failures must be a positive integer, got %q", value)
+			}
+		case "--output", "-o":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			value = strings.ToLower(value)
+			if value != "json" && value != "ndjson" {
+				return nil, cliConfig{}, fmt.Errorf("output must be json or ndjson, got %q", value)
+			}
+			config.output = value
+		case "--retry-failed":
+			value, err := nextValue()
+			if err != nil {
+				return nil, cliConfig{}, err
+			}
+			config.retryFailed = value
 		default:
 			if strings.HasPrefix(argument, "-") {
 				return nil, cliConfig{}, fmt.Errorf("unknown upload flag %q", argument)
@@ -92,6 +261,12 @@ func parseUploadArgs(args []string) ([]string, cliConfig, error) {
 		}
 	}
 
+	if (config.verifyBeforeDelete || config.trashDir != "") && !config.deleteFromHost {
+		return nil, cliConfig{}, fmt.Errorf("--verify-delete and --trash-dir require --delete")
+	}
+	if config.filters.MaxSize > 0 && config.filters.MinSize >= config.filters.MaxSize {
+		return nil, cliConfig{}, fmt.Errorf("--min-size must be smaller than --max-size")
+	}
 	if config.updateExistingPhotosToLive && !config.pairLivePhotos {
 		return nil, cliConfig{}, fmt.Errorf("--update-existing-photos-to-live requires --pair-live-photos")
 	}
@@ -101,13 +276,18 @@ func parseUploadArgs(args []string) ([]string, cliConfig, error) {
 	if config.skipIncompleteLivePhotosSet && !config.pairLivePhotos {
 		return nil, cliConfig{}, fmt.Errorf("--skip-incomplete-live-photos and --upload-incomplete-live-photos require --pair-live-photos")
 	}
-	if len(paths) == 0 {
-		return nil, cliConfig{}, fmt.Errorf("at least one file or directory path is required")
+	return paths, config, nil
+}
+
+// parseFilterDate accepts a date or a date and time in local time, or RFC 3339.
+func parseFilterDate(value string) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
 	}
-	for _, path := range paths {
-		if _, err := os.Stat(path); err != nil {
-			return nil, cliConfig{}, fmt.Errorf("invalid upload path %q: %w", path, err)
+	for _, layout := range []string{time.DateOnly, "2006-01-02T15:04:05", time.DateTime, "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
 		}
 	}
-	return paths, config, nil
+	return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD or YYYY-MM-DD HH:MM:SS", value)
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"app/backend"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// unlockCredentials asks for the vault passphrase when the credentials are
+// encrypted and neither a key file nor GOTOHP_PASSPHRASE opened the vault.
+func unlockCredentials() error {
+	if backend.CredentialsAvailable() {
+		return nil
+	}
+	if backend.AppConfig.CredentialVault.KDF != backend.CredentialVaultPassphrase || !term.IsTerminal(os.Stdin.Fd()) {
+		return backend.ErrCredentialsLocked
+	}
+	passphrase, err := readPassphrase("Passphrase: ")
+	if err != nil {
+		return err
+	}
+	return backend.OpenCredentialVault(passphrase)
+}
+
+// newPassphraseEnv supplies the new passphrase to creds rekey without a
+// terminal, since GOTOHP_PASSPHRASE holds the current one.
+const newPassphraseEnv = "GOTOHP_NEW_PASSPHRASE"
+
+// readNewPassphrase asks for the passphrase of a new vault twice. Without a
+// terminal it is taken from env.
+func readNewPassphrase(env string) (string, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		if passphrase := os.Getenv(env); passphrase != "" {
+			return passphrase, nil
+		}
+		return "", fmt.Errorf("no terminal to enter a passphrase; set %s or use --key-file", env)
+	}
+	passphrase, err := readPassphrase("New passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("passphrase cannot be empty")
+	}
+	confirmation, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirmation != passphrase {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(passphrase), nil
+}
+
+// handleVaultCommand runs creds lock, unlock and rekey.
+func handleVaultCommand(subcommand string, args []string) error {
+	keyFile := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--key-file":
+			if subcommand == "unlock" || i+1 >= len(args) {
+				return fmt.Errorf("usage: %s creds %s", cliExecutableName, vaultUsage(subcommand))
+			}
+			keyFile = args[i+1]
+			i++
+		default:
+			return fmt.Errorf("unknown argument %q\nusage: %s creds %s", args[i], cliExecutableName, vaultUsage(subcommand))
+		}
+	}
+
+	switch subcommand {
+	case "lock":
+		if backend.CredentialsEncrypted() {
+			return fmt.Errorf("credentials are already encrypted; use 'creds rekey' to change the key")
+		}
+	case "unlock", "rekey":
+		if !backend.CredentialsEncrypted() {
+			return fmt.Errorf("credentials are not encrypted; use 'creds lock' first")
+		}
+		if err := unlockCredentials(); err != nil {
+			return err
+		}
+	}
+
+	if subcommand == "unlock" {
+		if err := backend.DecryptCredentials(); err != nil {
+			return err
+		}
+		fmt.Println("✓ Credentials are stored in plain text again")
+		return nil
+	}
+
+	passphrase := ""
+	if keyFile == "" {
+		var err error
+		env := backend.PassphraseEnv
+		if subcommand == "rekey" {
+			env = newPassphraseEnv
+		}
+		if passphrase, err = readNewPassphrase(env); err != nil {
+			return err
+		}
+	}
+	if err := backend.EncryptCredentials(passphrase, keyFile); err != nil {
+		return err
+	}
+	if keyFile != "" {
+		fmt.Printf("✓ Credentials encrypted with key file %s\n", backend.AppConfig.CredentialVault.KeyFile)
+	} else {
+		fmt.Println("✓ Credentials encrypted with a passphrase")
+	}
+	return nil
+}
+
+func vaultUsage(subcommand string) string {
+	if subcommand == "unlock" {
+		return "unlock"
+	}
+	return subcommand + " [--key-file <path>]"
+}
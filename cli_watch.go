@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"app/backend"
+)
+
+func printWatchHelp() {
+	fmt.Printf("Usage: %s watch <dir> [<dir> ...] [flags]\n", cliExecutableName)
+	fmt.Println()
+	fmt.Println("Polls the directories and uploads new or changed files once they stop changing.")
+	fmt.Println("Runs until interrupted. Accepts every 'upload' flag except --retry-failed, --output and --no-tui.")
+	fmt.Println("\nFlags:")
+	fmt.Println("  --interval <duration>        Time between directory scans (default: 10s)")
+	fmt.Println("  --settle <duration>          Time a file's size and mtime must stay unchanged (default: 5s)")
+	fmt.Println("  --pair-window <duration>     Time to wait for the other half of a Live Photo (default: 1m)")
+	fmt.Println("                               Only used with --pair-live-photos")
+}
+
+// parseWatchArgs extracts the watch-only flags and hands the rest to
+// parseUploadArgs.
+func parseWatchArgs(args []string) ([]string, cliConfig, backend.WatchOptions, error) {
+	options := backend.DefaultWatchOptions
+	uploadArgs := make([]string, 0, len(args))
+	for index := 0; index < len(args); index++ {
+		argument := args[index]
+		var target *time.Duration
+		switch argument {
+		case "--interval":
+			target = &options.Interval
+		case "--settle":
+			target = &options.SettleTime
+		case "--pair-window":
+			target = &options.PairWindow
+		case "--retry-failed", "--no-tui", "--output", "-o":
+			return nil, cliConfig{}, options, fmt.Errorf("%s is not supported by watch", argument)
+		default:
+			uploadArgs = append(uploadArgs, argument)
+			continue
+		}
+		if index+1 >= len(args) {
+			return nil, cliConfig{}, options, fmt.Errorf("flag %s requires a value", argument)
+		}
+		index++
+		value, err := time.ParseDuration(args[index])
+		if err != nil || value < 0 {
+			return nil, cliConfig{}, options, fmt.Errorf("%s must be a duration like 30s or 2m, got %q", argument, args[index])
+		}
+		*target = value
+	}
+	if options.Interval == 0 {
+		return nil, cliConfig{}, options, fmt.Errorf("--interval must be greater than zero")
+	}
+
+	dirs, config, err := parseUploadArgs(uploadArgs)
+	if err != nil {
+		return nil, cliConfig{}, options, err
+	}
+	return dirs, config, options, nil
+}
+
+func runCLIWatch(dirs []string, config cliConfig, options backend.WatchOptions) error {
+	if err := applyCLIConfig(config); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	eventCallback := func(event string, data any) {
+		if event != "FileStatus" {
+			return
+		}
+		result, ok := data.(backend.FileUploadResult)
+		if !ok {
+			return
+		}
+		paths := result.Path
+		if len(result.Paths) > 1 {
+			paths = strings.Join(result.Paths, " + ")
+		}
+		timestamp := time.Now().Format(time.DateTime)
+		switch {
+		case result.IsError:
+			message := result.ErrorMessage
+			if message == "" && result.Error != nil {
+				message = result.Error.Error()
+			}
+			fmt.Printf("%s  ✗ %s: %s\n", timestamp, paths, message)
+		case result.Skipped:
+			fmt.Printf("%s  - %s: %s\n", timestamp, paths, result.SkipReason)
+		default:
+			fmt.Printf("%s  ✓ %s (%s)\n", timestamp, paths, result.MediaKey)
+		}
+	}
+
+	cliApp := backend.NewCLIApp(eventCallback, parseLogLevel(config.logLevel))
+	fmt.Fprintf(os.Stderr, "Watching %s every %s (Ctrl+C to stop)\n", strings.Join(dirs, ", "), options.Interval)
+	return backend.Watch(ctx, cliApp, dirs, options)
+}
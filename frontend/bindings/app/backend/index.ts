@@ -15,5 +15,6 @@ export {
     PreflightWarning,
     StartUploadEvent,
     ThreadStatus,
-    UploadBatchStart
+    UploadBatchStart,
+    UploadBatchTotal
 } from "./models.js";
@@ -398,5 +398,34 @@ export class UploadBatchStart {
     }
 }
 
+export class UploadBatchTotal {
+    "Total": number;
+    "TotalBytes": number;
+    "Scanning": boolean;
+
+    /** Creates a new UploadBatchTotal instance. */
+    constructor($$source: Partial<UploadBatchTotal> = {}) {
+        if (!("Total" in $$source)) {
+            this["Total"] = 0;
+        }
+        if (!("TotalBytes" in $$source)) {
+            this["TotalBytes"] = 0;
+        }
+        if (!("Scanning" in $$source)) {
+            this["Scanning"] = false;
+        }
+
+        Object.assign(this, $$source);
+    }
+
+    /**
+     * Creates a new UploadBatchTotal instance from a string or object.
+     */
+    static createFrom($$source: any = {}): UploadBatchTotal {
+        let $$parsedSource = typeof $$source === 'string' ? JSON.parse($$source) : $$source;
+        return new UploadBatchTotal($$parsedSource as Partial<UploadBatchTotal>);
+    }
+}
+
 // Private type creation functions
 const $$createType0 = $Create.Array($Create.Any);
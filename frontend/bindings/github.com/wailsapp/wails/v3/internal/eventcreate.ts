@@ -20,7 +20,8 @@ function configure() {
         "files-dropped": $$createType4,
         "startUpload": $$createType5,
         "uploadStart": $$createType6,
-        "uploadWarning": $$createType7,
+        "uploadTotal": $$createType7,
+        "uploadWarning": $$createType8,
     }));
 }
 
@@ -32,6 +33,7 @@ const $$createType3 = backend$0.AlbumError.createFrom;
 const $$createType4 = backend$0.FilesDroppedEvent.createFrom;
 const $$createType5 = backend$0.StartUploadEvent.createFrom;
 const $$createType6 = backend$0.UploadBatchStart.createFrom;
-const $$createType7 = backend$0.PreflightWarning.createFrom;
+const $$createType7 = backend$0.UploadBatchTotal.createFrom;
+const $$createType8 = backend$0.PreflightWarning.createFrom;
 
 configure();
@@ -22,6 +22,7 @@ declare module "@wailsio/runtime" {
             "uploadCancel": void;
             "uploadStart": backend$0.UploadBatchStart;
             "uploadStop": void;
+            "uploadTotal": backend$0.UploadBatchTotal;
             "uploadTotalBytes": number;
             "uploadTotalBytesDelta": number;
             "uploadWarning": backend$0.PreflightWarning;
@@ -39,6 +39,12 @@ export interface UploadBatchStart {
   TotalBytes: number;
 }
 
+export interface UploadBatchTotal {
+  Total: number;
+  TotalBytes: number;
+  Scanning: boolean;
+}
+
 export interface AlbumStatus {
   AlbumName: string;
   ItemsAdded: number;
@@ -52,12 +58,26 @@ export interface AlbumError {
   Error: string;
 }
 
+const skippedUploadWarningCodes = new Set([
+  "incomplete-live-photo-skipped",
+  "ambiguous-filename-stem",
+  "filtered-size",
+  "filtered-modified-time",
+  "filtered-filename-date",
+  "filtered-media-class",
+  "empty-file",
+  "file-too-large",
+  "truncated-file",
+]);
+
 function isSkippedUploadWarning(code: string): boolean {
-  return code === "incomplete-live-photo-skipped" || code === "ambiguous-filename-stem";
+  return skippedUploadWarningCodes.has(code);
 }
 
 export interface UploadState {
   isUploading: boolean;
+  // True while the backend is still scanning, so totalFiles can still grow.
+  isScanning: boolean;
   totalFiles: number;
   uploadedFiles: number;
   threads: Map<number, ThreadStatus>;
@@ -81,6 +101,7 @@ class UploadManager {
   // Reactive state that can be accessed by components
   public state = reactive<UploadState>({
     isUploading: false,
+    isScanning: false,
     totalFiles: 0,
     uploadedFiles: 0,
     threads: new Map<number, ThreadStatus>(),
@@ -134,6 +155,7 @@ class UploadManager {
       this.state.uploadedFiles = 0;
       this.state.uploadedBytes = 0;
       this.state.isUploading = true;
+      this.state.isScanning = true;
       this.state.threads.clear();
       this.state.startTime = Date.now();
       this.state.uploadSpeed = 0;
@@ -147,6 +169,13 @@ class UploadManager {
       this.state.warnings = [];
     });
 
+    // Totals grow while the scan finds more files
+    Events.On("uploadTotal", (event: { data: UploadBatchTotal }) => {
+      this.state.totalFiles = event.data.Total;
+      this.state.totalBytes = Math.max(0, event.data.TotalBytes + this.totalBytesAdjustment);
+      this.state.isScanning = event.data.Scanning;
+    });
+
     // Handle async total bytes update (calculated after uploadStart)
     Events.On("uploadTotalBytes", (event: { data: number }) => {
       this.state.totalBytes = Math.max(0, event.data + this.totalBytesAdjustment);
@@ -204,7 +233,8 @@ class UploadManager {
       // Skipped-only batches can begin and end within one backend event burst.
       // Finishing locally prevents a missed terminal event from leaving the timer running.
       if (
-        this.state.totalFiles > 0
+        !this.state.isScanning
+        && this.state.totalFiles > 0
         && this.state.uploadedFiles >= this.state.totalFiles
         && this.state.results.success.length === 0
         && this.state.results.fail.length === 0
@@ -216,6 +246,7 @@ class UploadManager {
     // Handle upload stop
     Events.On("uploadStop", () => {
       this.state.isUploading = false;
+      this.state.isScanning = false;
     });
 
     // Handle album creation progress